@@ -0,0 +1,189 @@
+package router
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	durationType        = reflect.TypeFor[time.Duration]()
+)
+
+// paramLocations lists the struct tags that bind request parameters, in the
+// order they are applied.
+var paramLocations = []string{"path", "query", "header", "cookie"}
+
+// bindParams fills the fields of v tagged with path, query, header or cookie
+// from req. Fields whose parameter is absent from the request are left
+// untouched.
+func bindParams(req *http.Request, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var query map[string][]string
+	var items []ErrorItem
+	var errs []error
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		for _, in := range paramLocations {
+			name := f.Tag.Get(in)
+			if name == "" {
+				continue
+			}
+
+			var values []string
+			switch in {
+			case "path":
+				if pv := req.PathValue(name); pv != "" {
+					values = []string{pv}
+				}
+			case "query":
+				if query == nil {
+					query = req.URL.Query()
+				}
+				values = query[name]
+			case "header":
+				values = req.Header.Values(name)
+			case "cookie":
+				for _, c := range req.CookiesNamed(name) {
+					values = append(values, c.Value)
+				}
+			}
+
+			if len(values) == 0 {
+				continue
+			}
+
+			// comma-separated lists only bind to slices
+			if (in == "path" || in == "header") && isList(f.Type) {
+				values = splitList(values)
+			}
+
+			if err := bindValue(v.Field(i), values); err != nil {
+				items = append(items, ErrorItem{
+					Name:   name,
+					Reason: err.Error(),
+					Metadata: map[string]any{
+						"in": in,
+					},
+				})
+				errs = append(errs, fmt.Errorf("%s parameter %q: %w", in, name, err))
+			}
+		}
+	}
+
+	if len(items) > 0 {
+		return BadRequestError{
+			Err:    errors.Join(errs...),
+			Detail: "Invalid request parameters",
+			Errors: items,
+		}
+	}
+
+	return nil
+}
+
+// isList reports whether a field of type t binds several values.
+func isList(t reflect.Type) bool {
+	t = indirect(t)
+	return t.Kind() == reflect.Slice && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func splitList(values []string) []string {
+	var parts []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			parts = append(parts, strings.TrimSpace(part))
+		}
+	}
+	return parts
+}
+
+func bindValue(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return bindValue(v.Elem(), values)
+	}
+
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+
+	if v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := bindValue(s.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+
+	return setString(v, values[0])
+}
+
+func setString(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported parameter type %s", v.Type())
+	}
+	return nil
+}
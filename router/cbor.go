@@ -0,0 +1,361 @@
+package router
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+)
+
+const contentTypeCbor = "application/cbor"
+
+// CBOR major types, RFC 8949 section 3.1.
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// CBORSerializer encodes values in the CBOR format of RFC 8949, using the
+// field names of their JSON encoding. Maps are written with sorted keys and
+// tags are ignored when decoding.
+type CBORSerializer struct{}
+
+func (CBORSerializer) Marshal(w io.Writer, v any) error {
+	tree, err := toTree(v)
+	if err != nil {
+		return err
+	}
+
+	data, err := appendCbor(nil, tree)
+	if err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (CBORSerializer) Unmarshal(data []byte, v any) error {
+	d := &cborDecoder{data: data}
+	tree, err := d.decode(0)
+	if err == nil && d.pos != len(data) {
+		err = errors.New("trailing data")
+	}
+	if err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+	return fromTree(tree, v)
+}
+
+func (CBORSerializer) ContentType() string {
+	return contentTypeCbor
+}
+
+func appendCbor(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborSimple|22), nil
+	case bool:
+		if v {
+			return append(b, cborSimple|21), nil
+		}
+		return append(b, cborSimple|20), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			if n < 0 {
+				return appendCborHead(b, cborNegInt, uint64(-1-n)), nil
+			}
+			return appendCborHead(b, cborUint, uint64(n)), nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return appendCborHead(b, cborUint, n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(b, cborSimple|27), math.Float64bits(f)), nil
+	case string:
+		return append(appendCborHead(b, cborText, uint64(len(v))), v...), nil
+	case []any:
+		b = appendCborHead(b, cborArray, uint64(len(v)))
+		var err error
+		for _, item := range v {
+			if b, err = appendCbor(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		b = appendCborHead(b, cborMap, uint64(len(v)))
+		var err error
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			b, _ = appendCbor(b, key)
+			if b, err = appendCbor(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// appendCborHead appends the initial byte of a data item of the given major
+// type followed by its argument n, in the shortest form.
+func appendCborHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+// cborDecoder decodes CBOR data into the generic values produced by toTree.
+// Byte strings are decoded as []byte.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) decode(depth int) (any, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("maximum nesting depth exceeded")
+	}
+
+	if d.pos >= len(d.data) {
+		return nil, errTruncated
+	}
+	c := d.data[d.pos]
+	d.pos++
+	major, info := c&0xe0, c&0x1f
+
+	if info == cborIndefinite {
+		return d.indefinite(major, depth)
+	}
+
+	if major == cborSimple {
+		return d.simple(info)
+	}
+
+	n, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("negative integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case cborBytes:
+		return d.bytes(n)
+	case cborText:
+		b, err := d.bytes(n)
+		return string(b), err
+	case cborArray:
+		// every item takes at least one byte
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, errTruncated
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case cborMap:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, errTruncated
+		}
+		m := make(map[string]any, n)
+		for range n {
+			if err := d.entry(m, depth); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default: // cborTag
+		return d.decode(depth + 1)
+	}
+}
+
+// argument reads the argument of a data item from its additional
+// information.
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info > 27 {
+		return 0, fmt.Errorf("invalid additional information %d", info)
+	}
+
+	b, err := d.bytes(1 << (info - 24))
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *cborDecoder) simple(info byte) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		n, err := d.argument(info)
+		return halfToFloat(uint16(n)), err
+	case 26:
+		n, err := d.argument(info)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 27:
+		n, err := d.argument(info)
+		return math.Float64frombits(n), err
+	default:
+		return nil, fmt.Errorf("unsupported simple value %d", info)
+	}
+}
+
+// indefinite decodes an item of indefinite length, terminated by a break.
+func (d *cborDecoder) indefinite(major byte, depth int) (any, error) {
+	if major < cborBytes || major > cborMap {
+		return nil, fmt.Errorf("invalid indefinite length major type %d", major>>5)
+	}
+
+	var chunks bytes.Buffer
+	var items []any
+	m := map[string]any{}
+
+	for {
+		if d.pos >= len(d.data) {
+			return nil, errTruncated
+		}
+		if d.data[d.pos] == cborBreak {
+			d.pos++
+			break
+		}
+
+		switch major {
+		case cborBytes, cborText:
+			if d.data[d.pos]&0xe0 != major || d.data[d.pos]&0x1f == cborIndefinite {
+				return nil, errors.New("invalid chunk in indefinite length string")
+			}
+			chunk, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch chunk := chunk.(type) {
+			case string:
+				chunks.WriteString(chunk)
+			case []byte:
+				chunks.Write(chunk)
+			}
+		case cborArray:
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		default:
+			if err := d.entry(m, depth); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch major {
+	case cborBytes:
+		return chunks.Bytes(), nil
+	case cborText:
+		return chunks.String(), nil
+	case cborArray:
+		if items == nil {
+			items = []any{}
+		}
+		return items, nil
+	default:
+		return m, nil
+	}
+}
+
+func (d *cborDecoder) entry(m map[string]any, depth int) error {
+	key, err := d.decode(depth + 1)
+	if err != nil {
+		return err
+	}
+	value, err := d.decode(depth + 1)
+	if err != nil {
+		return err
+	}
+	m[treeKey(key)] = value
+	return nil
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float, RFC 8949 appendix D.
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
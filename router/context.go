@@ -3,9 +3,14 @@ package router
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -39,13 +44,27 @@ type ctx[T any] interface {
 
 	Status() int
 	SetStatus(code int)
+
+	Output() any
+	SetOutput(v any)
+
+	contextAny() *ContextAny
 }
 
 type ContextAny struct {
-	res          http.ResponseWriter
-	req          *http.Request
-	statusCode   int
-	isNextCalled bool
+	res       *responseWriter
+	req       *http.Request
+	next      func() error
+	output    any
+	hasOutput bool // the handler ran or SetOutput was called
+
+	serializers map[string]Serializer
+	consumes    []string
+	contentType string
+	serializer  Serializer
+
+	formMemory int64
+	formDisk   int64
 }
 
 type Context[Body any] struct {
@@ -120,11 +139,24 @@ func (ctx *ContextAny) SetQueryParam(key, value string) {
 }
 
 func (ctx *ContextAny) Status() int {
-	return ctx.statusCode
+	return ctx.res.status
 }
 
+// SetStatus sets the status code of the response. It has no effect once the
+// response is committed.
 func (ctx *ContextAny) SetStatus(code int) {
-	ctx.statusCode = code
+	ctx.res.WriteHeader(code)
+}
+
+// Committed reports whether the status line and headers have been sent.
+// Headers set afterwards are ignored.
+func (ctx *ContextAny) Committed() bool {
+	return ctx.res.committed
+}
+
+// BytesWritten returns the number of bytes of response body written so far.
+func (ctx *ContextAny) BytesWritten() int64 {
+	return ctx.res.written
 }
 
 func (ctx *ContextAny) Body() any {
@@ -139,9 +171,31 @@ func (ctx *ContextAny) BodyRaw() io.ReadCloser {
 	return ctx.Request().Body
 }
 
+// Next runs the rest of the middleware chain and the handler, and returns
+// their error. Middlewares that do not call it stop the request before the
+// handler runs: the response then only has a body if they set an output with
+// SetOutput or wrote it themselves. Calling it more than once returns the
+// result of the first call.
 func (ctx *ContextAny) Next() error {
-	ctx.isNextCalled = true
-	return nil
+	if ctx.next == nil {
+		return nil
+	}
+	return ctx.next()
+}
+
+// Output returns the value returned by the handler, once Next has returned.
+func (ctx *ContextAny) Output() any {
+	return ctx.output
+}
+
+// SetOutput replaces the value serialized as the response body.
+func (ctx *ContextAny) SetOutput(v any) {
+	ctx.output = v
+	ctx.hasOutput = true
+}
+
+func (ctx *ContextAny) contextAny() *ContextAny {
+	return ctx
 }
 
 func (ctx *ContextAny) Request() *http.Request {
@@ -166,17 +220,75 @@ func (ctx *Context[Body]) GetBody() (Body, error) {
 	}
 
 	body := new(Body)
-	if ctx.req.ContentLength > 0 && ctx.req.Body != http.NoBody {
-		if err := json.NewDecoder(ctx.req.Body).Decode(body); err != nil {
-			return *body, fmt.Errorf("could not read incoming request")
+	if mediaType, ok := ctx.formMediaType(); ok && ctx.req.Body != nil {
+		if err := ctx.bindForm(mediaType, reflect.ValueOf(body)); err != nil {
+			return *body, err
+		}
+	} else if ctx.req.Body != nil && ctx.req.Body != http.NoBody {
+		data, err := io.ReadAll(ctx.req.Body)
+		if err != nil {
+			return *body, fmt.Errorf("could not read incoming request: %w", err)
+		}
+
+		if len(data) > 0 {
+			serializer, err := ctx.requestSerializer()
+			if err != nil {
+				return *body, err
+			}
+			if err := serializer.Unmarshal(data, body); err != nil {
+				return *body, decodeError(err)
+			}
 		}
 	}
 
-	// if err := validator.Default().Struct(body); err != nil {
-	// 	// _ = err.(validator.ValidationErrors)
-	// 	return *body, UnprocessableEntityError{Err: err}
-	// }
+	if err := bindParams(ctx.req, reflect.ValueOf(body)); err != nil {
+		return *body, err
+	}
+
+	if err := validate(reflect.ValueOf(body)); err != nil {
+		return *body, err
+	}
 
 	ctx.body = body
 	return *ctx.body, nil
 }
+
+// decodeError reports a request body the serializer could not decode as a bad
+// request. JSON errors are left to mapError, which reports the offset of syntax
+// errors and turns type errors into unprocessable entities.
+func decodeError(err error) error {
+	var errorStatus Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	err = fmt.Errorf("could not read incoming request: %w", err)
+	if errors.As(err, &errorStatus) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return err
+	}
+	return BadRequestError{Err: err, Detail: "The request body is malformed"}
+}
+
+// requestSerializer returns the serializer matching the Content-Type of the
+// request. Requests without a Content-Type are decoded with the first media
+// type the route consumes.
+func (ctx *ContextAny) requestSerializer() (Serializer, error) {
+	contentType := ctx.Header(xContentType)
+	if contentType == "" && len(ctx.consumes) > 0 {
+		contentType = ctx.consumes[0]
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, UnsupportedMediaTypeError{Err: fmt.Errorf("invalid content type %q: %w", contentType, err)}
+	}
+
+	if slices.Contains(ctx.consumes, mediaType) {
+		if serializer, ok := ctx.serializers[mediaType]; ok {
+			return serializer, nil
+		}
+	}
+
+	return nil, UnsupportedMediaTypeError{
+		Err:    fmt.Errorf("unsupported content type %q", mediaType),
+		Detail: fmt.Sprintf("Content type %q is not supported, expected one of: %s", mediaType, strings.Join(ctx.consumes, ", ")),
+	}
+}
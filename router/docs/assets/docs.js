@@ -0,0 +1,304 @@
+(function () {
+  "use strict";
+
+  var METHODS = ["get", "put", "post", "delete", "options", "head", "patch", "trace"];
+  var MAX_DEPTH = 6;
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      if (key === "text") {
+        node.textContent = attrs[key];
+      } else {
+        node.setAttribute(key, attrs[key]);
+      }
+    });
+    (children || []).forEach(function (child) {
+      if (child) {
+        node.appendChild(typeof child === "string" ? document.createTextNode(child) : child);
+      }
+    });
+    return node;
+  }
+
+  // annotated references are wrapped in a single allOf, whose annotations
+  // take precedence over the referenced schema, and nullable references in a
+  // oneOf with the null type
+  function wrapped(obj) {
+    if (obj && obj.allOf && obj.allOf.length === 1) {
+      return obj.allOf[0];
+    }
+    if (obj && obj.oneOf && obj.oneOf.length === 2 && obj.oneOf[1].type === "null") {
+      return obj.oneOf[0];
+    }
+    return null;
+  }
+
+  function resolve(spec, obj) {
+    var inner = wrapped(obj);
+    if (inner) {
+      var merged = Object.assign({}, resolve(spec, inner), obj);
+      delete merged.allOf;
+      delete merged.oneOf;
+      if (obj.oneOf) {
+        merged.type = [].concat(merged.type || "object", "null");
+      }
+      return merged;
+    }
+    var seen = 0;
+    while (obj && obj.$ref && seen++ < 32) {
+      var target = spec;
+      obj.$ref.replace(/^#\//, "").split("/").forEach(function (part) {
+        part = decodeURIComponent(part.replace(/~1/g, "/").replace(/~0/g, "~"));
+        target = target ? target[part] : undefined;
+      });
+      obj = target;
+    }
+    return obj || {};
+  }
+
+  function refName(obj) {
+    if (wrapped(obj)) {
+      return refName(wrapped(obj));
+    }
+    return obj && obj.$ref ? decodeURIComponent(obj.$ref.split("/").pop()) : "";
+  }
+
+  function typeLabel(spec, schema) {
+    var name = refName(schema);
+    var s = resolve(spec, schema);
+    var types = [].concat(s.type || (s.properties ? "object" : "any"));
+    var nullable = types.length > 1 && types.indexOf("null") >= 0;
+    var type = types.filter(function (t) { return !nullable || t !== "null"; }).join(" | ");
+    if (type === "array" && s.items) {
+      type = "array<" + typeLabel(spec, s.items) + ">";
+    } else if (type === "object" && s.additionalProperties && typeof s.additionalProperties === "object") {
+      type = "map<string, " + typeLabel(spec, s.additionalProperties) + ">";
+    }
+    if (nullable) {
+      type += " | null";
+    }
+    if (name) {
+      type = name.split(".").pop() + " (" + type + ")";
+    }
+    if (s.format) {
+      type += " <" + s.format + ">";
+    }
+    return type;
+  }
+
+  function constraints(s) {
+    var out = [];
+    [
+      ["minimum", ">= "], ["maximum", "<= "],
+      ["minLength", "min length "], ["maxLength", "max length "],
+      ["minItems", "min items "], ["maxItems", "max items "],
+      ["pattern", "pattern "]
+    ].forEach(function (c) {
+      if (s[c[0]] !== undefined) {
+        out.push(c[1] + s[c[0]]);
+      }
+    });
+    if (s.enum) {
+      out.push("one of " + s.enum.map(function (v) { return JSON.stringify(v); }).join(", "));
+    }
+    if (s.default !== undefined) {
+      out.push("default " + JSON.stringify(s.default));
+    }
+    if (s.example !== undefined) {
+      out.push("example " + JSON.stringify(s.example));
+    }
+    if (s.deprecated) { out.push("deprecated"); }
+    if (s.readOnly) { out.push("read only"); }
+    if (s.writeOnly) { out.push("write only"); }
+    return out.join(", ");
+  }
+
+  function renderSchema(spec, schema, depth, seen) {
+    var s = resolve(spec, schema);
+    var name = refName(schema);
+    if (depth > MAX_DEPTH || (name && seen.indexOf(name) >= 0)) {
+      return el("div", { "class": "schema muted", text: "(recursive " + (name || "schema") + ")" });
+    }
+    seen = name ? seen.concat([name]) : seen;
+
+    if (s.items) {
+      return renderSchema(spec, s.items, depth + 1, seen);
+    }
+    if (!s.properties) {
+      return null;
+    }
+
+    var required = s.required || [];
+    var box = el("div", { "class": "schema" });
+    Object.keys(s.properties).forEach(function (key) {
+      var prop = s.properties[key];
+      var resolved = resolve(spec, prop);
+      box.appendChild(el("div", { "class": "prop" }, [
+        el("span", { "class": "name", text: key }), " ",
+        el("span", { "class": "type", text: typeLabel(spec, prop) }), " ",
+        required.indexOf(key) >= 0 ? el("span", { "class": "required", text: "required" }) : null, " ",
+        el("span", { "class": "constraint", text: constraints(resolved) }),
+        resolved.description ? el("div", { "class": "muted", text: resolved.description }) : null,
+        renderSchema(spec, prop, depth + 1, seen)
+      ]));
+    });
+    return box;
+  }
+
+  function renderContent(spec, content) {
+    var out = [];
+    Object.keys(content || {}).forEach(function (mediaType, i) {
+      out.push(el("div", { "class": "media", text: mediaType }));
+      if (i === 0) {
+        var schema = content[mediaType].schema;
+        if (schema) {
+          out.push(el("div", {}, [el("code", { text: typeLabel(spec, schema) })]));
+          out.push(renderSchema(spec, schema, 0, []));
+        }
+      }
+    });
+    return out;
+  }
+
+  function renderParameters(spec, params) {
+    if (!params || !params.length) {
+      return null;
+    }
+    var rows = params.map(function (p) {
+      p = resolve(spec, p);
+      return el("tr", {}, [
+        el("td", {}, [el("code", { text: p.name })]),
+        el("td", { text: p.in }),
+        el("td", { text: p.schema ? typeLabel(spec, p.schema) : "" }),
+        el("td", { text: p.required ? "yes" : "" }),
+        el("td", { text: p.description || (p.schema ? constraints(resolve(spec, p.schema)) : "") })
+      ]);
+    });
+    return el("div", {}, [
+      el("h4", { text: "Parameters" }),
+      el("table", {}, [
+        el("tr", {}, ["Name", "In", "Type", "Required", "Description"].map(function (h) {
+          return el("th", { text: h });
+        }))
+      ].concat(rows))
+    ]);
+  }
+
+  function renderResponses(spec, responses) {
+    var codes = Object.keys(responses || {});
+    if (!codes.length) {
+      return null;
+    }
+    var box = el("div", {}, [el("h4", { text: "Responses" })]);
+    codes.forEach(function (code) {
+      var r = resolve(spec, responses[code]);
+      box.appendChild(el("div", {}, [
+        el("span", { "class": "status s" + code.charAt(0), text: code }), " ",
+        el("span", { text: r.description || "" })
+      ].concat(renderContent(spec, r.content))));
+    });
+    return box;
+  }
+
+  function renderOperation(spec, id, method, path, op) {
+    var body = el("div", { "class": "body" }, [
+      op.description && op.description !== op.summary ? el("p", { text: op.description }) : null,
+      op.externalDocs ? el("p", {}, [el("a", { href: op.externalDocs.url, text: op.externalDocs.description || op.externalDocs.url })]) : null,
+      renderParameters(spec, op.parameters)
+    ]);
+
+    var rb = resolve(spec, op.requestBody);
+    if (rb.content && !/^(get|head|delete)$/.test(method)) {
+      body.appendChild(el("h4", { text: "Request body" }));
+      renderContent(spec, rb.content).forEach(function (n) { if (n) { body.appendChild(n); } });
+    }
+
+    var responses = Object.assign({}, op.responses);
+    if (responses["default"]) {
+      var d = responses["default"];
+      delete responses["default"];
+      responses["default"] = d;
+    }
+    body.appendChild(renderResponses(spec, responses));
+
+    return el("details", { "class": "op" + (op.deprecated ? " deprecated" : ""), id: id }, [
+      el("summary", {}, [
+        el("span", { "class": "method " + method, text: method }),
+        el("span", { "class": "path", text: path }),
+        el("span", { "class": "muted", text: op.summary || "" })
+      ]),
+      body
+    ]);
+  }
+
+  function render(spec) {
+    var info = spec.info || {};
+    document.title = (info.title || "API") + " reference";
+    var header = document.getElementById("info");
+    header.appendChild(el("h1", {}, [info.title || "API", el("span", { "class": "version", text: info.version || "" })]));
+    if (info.description) {
+      header.appendChild(el("p", { "class": "muted", text: info.description }));
+    }
+    header.appendChild(el("a", { href: "openapi.json", text: "openapi.json" }));
+    header.appendChild(document.createTextNode(" · "));
+    header.appendChild(el("a", { href: "openapi.yaml", text: "openapi.yaml" }));
+
+    var groups = {};
+    var order = [];
+    Object.keys(spec.paths || {}).forEach(function (path) {
+      var item = spec.paths[path];
+      METHODS.forEach(function (method) {
+        var op = item[method];
+        if (!op) {
+          return;
+        }
+        (op.tags && op.tags.length ? op.tags : ["default"]).forEach(function (tag) {
+          if (!groups[tag]) {
+            groups[tag] = [];
+            order.push(tag);
+          }
+          groups[tag].push({ method: method, path: path, op: op });
+        });
+      });
+    });
+
+    var nav = document.getElementById("nav");
+    var content = document.getElementById("content");
+    content.textContent = "";
+    order.forEach(function (tag, t) {
+      nav.appendChild(el("h3", { text: tag }));
+      content.appendChild(el("h2", { "class": "tag", text: tag }));
+      groups[tag].forEach(function (entry, i) {
+        var id = "op-" + t + "-" + i;
+        nav.appendChild(el("a", { href: "#" + id, title: entry.method.toUpperCase() + " " + entry.path }, [
+          el("span", { "class": "method " + entry.method, text: entry.method }), " ",
+          entry.op.summary || entry.path
+        ]));
+        content.appendChild(renderOperation(spec, id, entry.method, entry.path, entry.op));
+      });
+    });
+
+    if (location.hash) {
+      var target = document.getElementById(location.hash.slice(1));
+      if (target) {
+        target.open = true;
+        target.scrollIntoView();
+      }
+    }
+  }
+
+  fetch("openapi.json")
+    .then(function (res) {
+      if (!res.ok) {
+        throw new Error(res.status + " " + res.statusText);
+      }
+      return res.json();
+    })
+    .then(render)
+    .catch(function (err) {
+      var content = document.getElementById("content");
+      content.textContent = "";
+      content.appendChild(el("p", { text: "Could not load the schema: " + err.message }));
+    });
+})();
@@ -1,8 +1,12 @@
 package router
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 var (
@@ -38,8 +42,19 @@ var (
 	_ Error = (*TooManyRequestsError)(nil)
 	_ Error = (*RequestHeaderFieldsTooLargeError)(nil)
 	_ Error = (*UnavailableForLegalReasonsError)(nil)
+	_ Error = (*ClientClosedRequestError)(nil)
+	_ Error = (*InternalServerError)(nil)
+	_ Error = (*NotImplementedError)(nil)
+	_ Error = (*BadGatewayError)(nil)
+	_ Error = (*ServiceUnavailableError)(nil)
+	_ Error = (*GatewayTimeoutError)(nil)
+	_ Error = (*InsufficientStorageError)(nil)
 )
 
+// StatusClientClosedRequest is the non-standard status code used when the
+// client closes the connection before the response is sent.
+const StatusClientClosedRequest = 499
+
 type Error interface {
 	error
 	StatusCode() int
@@ -47,18 +62,27 @@ type Error interface {
 
 type ErrorProcessor func(err error) error
 
+// HTTPError is a problem details object as defined by RFC 9457. Extensions
+// are serialized as additional members of the object.
 type HTTPError struct {
-	Err    error       `json:"-"`
-	Title  string      `json:"title,omitzero"  description:"Short title of the error"`
-	Status int         `json:"status,omitzero" description:"HTTP status code"             example:"404"`
-	Detail string      `json:"detail,omitzero" description:"Human readable error message"`
-	Errors []ErrorItem `json:"errors,omitzero"`
+	Err        error          `json:"-"`
+	Type       string         `json:"type,omitzero"     description:"URI reference identifying the problem type"`
+	Title      string         `json:"title,omitzero"    description:"Short title of the error"`
+	Status     int            `json:"status,omitzero"   description:"HTTP status code"                            example:"404"`
+	Detail     string         `json:"detail,omitzero"   description:"Human readable error message"`
+	Instance   string         `json:"instance,omitzero" description:"URI reference identifying this occurrence"`
+	Errors     []ErrorItem    `json:"errors,omitzero"`
+	Extensions map[string]any `json:"-"`
+
+	// RetryAfter is sent as the Retry-After header when positive, typically
+	// with ServiceUnavailableError and TooManyRequestsError.
+	RetryAfter time.Duration `json:"-"`
 }
 
 type ErrorItem struct {
-	Name     string         `json:"name"`
-	Reason   string         `json:"reason"`
-	Metadata map[string]any `json:"metadata,omitzero"`
+	Name     string         `json:"name"              xml:"name"`
+	Reason   string         `json:"reason"            xml:"reason"`
+	Metadata map[string]any `json:"metadata,omitzero" xml:"-"`
 }
 
 func (e HTTPError) Error() string {
@@ -263,21 +287,115 @@ func (e UnavailableForLegalReasonsError) StatusCode() int {
 }
 func (e UnavailableForLegalReasonsError) Unwrap() error { return HTTPError(e) }
 
+type ClientClosedRequestError HTTPError
+
+func (e ClientClosedRequestError) Error() string   { return e.Err.Error() }
+func (e ClientClosedRequestError) StatusCode() int { return StatusClientClosedRequest }
+func (e ClientClosedRequestError) Unwrap() error   { return HTTPError(e) }
+
+type InternalServerError HTTPError
+
+func (e InternalServerError) Error() string   { return e.Err.Error() }
+func (e InternalServerError) StatusCode() int { return http.StatusInternalServerError }
+func (e InternalServerError) Unwrap() error   { return HTTPError(e) }
+
+type NotImplementedError HTTPError
+
+func (e NotImplementedError) Error() string   { return e.Err.Error() }
+func (e NotImplementedError) StatusCode() int { return http.StatusNotImplemented }
+func (e NotImplementedError) Unwrap() error   { return HTTPError(e) }
+
+type BadGatewayError HTTPError
+
+func (e BadGatewayError) Error() string   { return e.Err.Error() }
+func (e BadGatewayError) StatusCode() int { return http.StatusBadGateway }
+func (e BadGatewayError) Unwrap() error   { return HTTPError(e) }
+
+type ServiceUnavailableError HTTPError
+
+func (e ServiceUnavailableError) Error() string   { return e.Err.Error() }
+func (e ServiceUnavailableError) StatusCode() int { return http.StatusServiceUnavailable }
+func (e ServiceUnavailableError) Unwrap() error   { return HTTPError(e) }
+
+type GatewayTimeoutError HTTPError
+
+func (e GatewayTimeoutError) Error() string   { return e.Err.Error() }
+func (e GatewayTimeoutError) StatusCode() int { return http.StatusGatewayTimeout }
+func (e GatewayTimeoutError) Unwrap() error   { return HTTPError(e) }
+
+type InsufficientStorageError HTTPError
+
+func (e InsufficientStorageError) Error() string   { return e.Err.Error() }
+func (e InsufficientStorageError) StatusCode() int { return http.StatusInsufficientStorage }
+func (e InsufficientStorageError) Unwrap() error   { return HTTPError(e) }
+
+// mapError converts well-known errors from the standard library into typed
+// errors. Errors that already carry a status code are returned unchanged.
+func mapError(err error) error {
+	var errorStatus Error
+	if err == nil || errors.As(err, &errorStatus) {
+		return err
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return GatewayTimeoutError{Err: err, Detail: "The request did not complete in time"}
+	case errors.Is(err, context.Canceled):
+		return ClientClosedRequestError{Err: err, Detail: "The request was canceled"}
+	case errors.As(err, &maxBytesErr):
+		return RequestEntityTooLargeError{
+			Err:    err,
+			Detail: fmt.Sprintf("The request body exceeds the limit of %d bytes", maxBytesErr.Limit),
+		}
+	case errors.As(err, &syntaxErr):
+		return BadRequestError{
+			Err:    err,
+			Detail: fmt.Sprintf("The request body is malformed at offset %d", syntaxErr.Offset),
+		}
+	case errors.As(err, &typeErr):
+		name := typeErr.Field
+		if name == "" {
+			name = "body"
+		}
+		return UnprocessableEntityError{
+			Err:    err,
+			Detail: "The request body has invalid values",
+			Errors: []ErrorItem{{
+				Name:   name,
+				Reason: fmt.Sprintf("must be of type %s, got %s", typeErr.Type, typeErr.Value),
+			}},
+		}
+	default:
+		return err
+	}
+}
+
 func defaultErrorProcessor(err error) error {
+	err = mapError(err)
 	errResponse := HTTPError{
 		Err:    err,
 		Status: http.StatusInternalServerError,
 		Detail: "An unexpected error occurred",
 	}
 
-	if httpErr, ok := err.(HTTPError); ok {
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
 		errResponse = httpErr
 	}
 
-	if errorStatus, ok := err.(Error); ok {
+	var errorStatus Error
+	if errors.As(err, &errorStatus) {
 		errResponse.Status = errorStatus.StatusCode()
 	}
 
+	if errResponse.Detail == "" && errResponse.Err != nil && errResponse.Status < 500 {
+		errResponse.Detail = errResponse.Err.Error()
+	}
+
 	if errResponse.Title == "" {
 		errResponse.Title = http.StatusText(errResponse.Status)
 	}
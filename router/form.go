@@ -0,0 +1,223 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const (
+	formTag = "form"
+
+	contentTypeForm      = "application/x-www-form-urlencoded"
+	contentTypeMultipart = "multipart/form-data"
+
+	defaultFormMemory = 32 << 20
+	defaultFormDisk   = 256 << 20
+)
+
+var (
+	fileHeaderType  = reflect.TypeFor[multipart.FileHeader]()
+	fileHeadersType = reflect.TypeFor[[]*multipart.FileHeader]()
+)
+
+// formContentTypes returns the media types an input of type t is bound
+// from when it has fields tagged with form, or nil otherwise. Inputs with
+// file fields only accept multipart forms.
+func formContentTypes(t reflect.Type) []string {
+	t = indirect(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var hasForm, hasFile bool
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get(formTag) == "" {
+			continue
+		}
+		hasForm = true
+		if indirect(f.Type) == fileHeaderType || f.Type == fileHeadersType {
+			hasFile = true
+		}
+	}
+
+	switch {
+	case !hasForm:
+		return nil
+	case hasFile:
+		return []string{contentTypeMultipart}
+	default:
+		return []string{contentTypeMultipart, contentTypeForm}
+	}
+}
+
+// formMediaType returns the media type of the request when it is a form the
+// route consumes. URL-encoded forms are left to FormSerializer when it is
+// registered.
+func (ctx *ContextAny) formMediaType() (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(ctx.Header(xContentType))
+	if err != nil || (mediaType != contentTypeMultipart && mediaType != contentTypeForm) {
+		return "", false
+	}
+	if _, ok := ctx.serializers[mediaType]; ok {
+		return "", false
+	}
+	return mediaType, slices.Contains(ctx.consumes, mediaType)
+}
+
+// limitFormBody caps the request body at the form limits of the router.
+func (ctx *ContextAny) limitFormBody() {
+	ctx.req.Body = http.MaxBytesReader(ctx.res, ctx.req.Body, ctx.formMemory+ctx.formDisk)
+}
+
+// bindForm parses a form request body and fills the fields of v tagged with
+// form. Files of multipart forms larger than the memory limit are stored in
+// temporary files, which are removed once the request is served.
+func (ctx *ContextAny) bindForm(mediaType string, v reflect.Value) error {
+	ctx.limitFormBody()
+
+	var err error
+	if mediaType == contentTypeMultipart {
+		err = ctx.req.ParseMultipartForm(ctx.formMemory)
+	} else {
+		err = ctx.req.ParseForm()
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return fmt.Errorf("could not read incoming request: %w", err)
+		}
+		return BadRequestError{Err: err, Detail: "The form is malformed"}
+	}
+
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var files map[string][]*multipart.FileHeader
+	if ctx.req.MultipartForm != nil {
+		files = ctx.req.MultipartForm.File
+	}
+
+	var invalid invalidFormFields
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get(formTag)
+		if !f.IsExported() || name == "" {
+			continue
+		}
+
+		switch {
+		case f.Type == reflect.PointerTo(fileHeaderType):
+			if fh := files[name]; len(fh) > 0 {
+				v.Field(i).Set(reflect.ValueOf(fh[0]))
+			}
+		case f.Type == fileHeadersType:
+			if fh := files[name]; len(fh) > 0 {
+				v.Field(i).Set(reflect.ValueOf(fh))
+			}
+		default:
+			values := ctx.req.PostForm[name]
+			if len(values) == 0 {
+				continue
+			}
+			if err := bindValue(v.Field(i), values); err != nil {
+				invalid.add(name, err)
+			}
+		}
+	}
+
+	return invalid.err()
+}
+
+// invalidFormFields collects the form fields that could not be bound.
+type invalidFormFields struct {
+	items []ErrorItem
+	errs  []error
+}
+
+func (f *invalidFormFields) add(name string, err error) {
+	f.items = append(f.items, ErrorItem{
+		Name:   name,
+		Reason: err.Error(),
+		Metadata: map[string]any{
+			"in": formTag,
+		},
+	})
+	f.errs = append(f.errs, fmt.Errorf("form field %q: %w", name, err))
+}
+
+// err returns a BadRequestError listing the invalid fields, if any.
+func (f *invalidFormFields) err() error {
+	if len(f.items) == 0 {
+		return nil
+	}
+	return BadRequestError{
+		Err:    errors.Join(f.errs...),
+		Detail: "Invalid form fields",
+		Errors: f.items,
+	}
+}
+
+// formName returns the name of the form field of sf: its form tag, or its
+// JSON name for fields without one.
+func formName(sf reflect.StructField) (string, bool) {
+	if name := sf.Tag.Get(formTag); name != "" {
+		before, _, _ := strings.Cut(name, ",")
+		return before, before == "-"
+	}
+	return propName(sf)
+}
+
+// Parts streams the parts of a multipart/form-data request body without
+// storing them, for uploads too large for GetBody. The body is limited to the
+// form limits of the router. It cannot be used together with GetBody.
+func (ctx *ContextAny) Parts() iter.Seq2[*multipart.Part, error] {
+	return func(yield func(*multipart.Part, error) bool) {
+		if mediaType, _, _ := mime.ParseMediaType(ctx.Header(xContentType)); mediaType != contentTypeMultipart {
+			yield(nil, UnsupportedMediaTypeError{
+				Err:    fmt.Errorf("unsupported content type %q", ctx.Header(xContentType)),
+				Detail: "Expected a multipart/form-data request body",
+			})
+			return
+		}
+
+		ctx.limitFormBody()
+		reader, err := ctx.req.MultipartReader()
+		if err != nil {
+			yield(nil, BadRequestError{Err: err, Detail: "The form is malformed"})
+			return
+		}
+
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if !errors.As(err, &maxBytesErr) {
+					err = BadRequestError{Err: err, Detail: "The form is malformed"}
+				}
+				yield(nil, err)
+				return
+			}
+			if !yield(part, nil) {
+				return
+			}
+		}
+	}
+}
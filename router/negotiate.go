@@ -0,0 +1,92 @@
+package router
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const xAccept = "Accept"
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header into media ranges. Malformed ranges
+// are ignored.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+
+	return ranges
+}
+
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (a acceptRange) matches(mediaType string) bool {
+	if a.mediaType == "*/*" || a.mediaType == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(a.mediaType, "*")
+	return ok && strings.HasPrefix(mediaType, prefix)
+}
+
+// negotiate picks the offer preferred by the Accept header. Offers are given
+// in server preference order, which breaks ties. An empty header accepts the
+// first offer, and so does a header without any valid media range.
+func negotiate(header string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+
+	ranges := parseAccept(header)
+	if len(ranges) == 0 {
+		return offers[0], true
+	}
+
+	best, bestQ, bestSpec := "", 0.0, -1
+	for _, offer := range offers {
+		// the most specific matching range decides the q-value of an offer
+		q, spec := 0.0, -1
+		for _, r := range ranges {
+			if s := specificity(r.mediaType); r.matches(offer) && s > spec {
+				q, spec = r.q, s
+			}
+		}
+
+		if q > bestQ || (q == bestQ && q > 0 && spec > bestSpec) {
+			best, bestQ, bestSpec = offer, q, spec
+		}
+	}
+
+	return best, bestQ > 0
+}
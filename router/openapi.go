@@ -0,0 +1,129 @@
+package router
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.grass.garden/utils"
+)
+
+const contentTypeYaml = "application/yaml"
+
+type renderedSchema struct {
+	contentType string
+	body        []byte
+	etag        string
+}
+
+// openAPIHandler serves the schema of a router. The document is rendered on
+// the first request, once every route has been registered, and then cached.
+type openAPIHandler struct {
+	router *Router
+	once   sync.Once
+	json   renderedSchema
+	yaml   renderedSchema
+	err    error
+}
+
+// OpenAPI serves the schema of the router as JSON at prefix/openapi.json and
+// as YAML at prefix/openapi.yaml.
+func (r *Router) OpenAPI(prefix string) *Router {
+	h := &openAPIHandler{router: r}
+	r.Handle(http.MethodGet+" "+joinPattern(prefix, "/openapi.json"), http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		h.serve(res, req, &h.json)
+	}))
+	r.Handle(http.MethodGet+" "+joinPattern(prefix, "/openapi.yaml"), http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		h.serve(res, req, &h.yaml)
+	}))
+	return r
+}
+
+func (h *openAPIHandler) render() {
+	doc := h.router.Schema()
+
+	body, err := doc.RenderJSON("  ")
+	if err != nil {
+		h.err = err
+		return
+	}
+	h.json = newRenderedSchema(contentTypeJson, body)
+
+	if body, err = doc.Render(); err != nil {
+		h.err = err
+		return
+	}
+	h.yaml = newRenderedSchema(contentTypeYaml, body)
+}
+
+func (h *openAPIHandler) serve(res http.ResponseWriter, req *http.Request, schema *renderedSchema) {
+	h.once.Do(h.render)
+	if h.err != nil {
+		http.Error(res, h.err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("ETag", schema.etag)
+	res.Header().Set(xContentType, schema.contentType)
+	if noneMatch(req.Header.Values("If-None-Match"), schema.etag) {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	_, _ = res.Write(schema.body)
+}
+
+// noneMatch reports whether If-None-Match header values list etag, using the
+// weak comparison of RFC 9110 section 13.1.2: W/ prefixes are ignored.
+func noneMatch(values []string, etag string) bool {
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newRenderedSchema(contentType string, body []byte) renderedSchema {
+	sum := sha256.Sum256(body)
+	return renderedSchema{
+		contentType: contentType,
+		body:        body,
+		etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}
+}
+
+//go:embed docs
+var docsFS embed.FS
+
+// Docs serves an API reference page for the schema of the router at pattern,
+// along with the documents registered by OpenAPI under the same prefix. All of
+// its assets are embedded, so it works without network access.
+func (r *Router) Docs(pattern string) *Router {
+	r.OpenAPI(pattern)
+
+	root := utils.Must(fs.Sub(docsFS, "docs"))
+	assets := http.FileServerFS(root)
+
+	// the prefix is resolved per request, as r may be mounted later
+	r.Handle(http.MethodGet+" "+joinPattern(pattern, "/{$}"), http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.ServeFileFS(res, req, root, "index.html")
+	}))
+	r.Handle(http.MethodGet+" "+joinPattern(pattern, "/assets/"), http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.StripPrefix(joinPattern(r.prefix(), pattern), assets).ServeHTTP(res, req)
+	}))
+	if joinPattern(r.prefix(), pattern) != "" {
+		r.Handle(http.MethodGet+" "+joinPattern(pattern, "/"), http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			http.Redirect(res, req, joinPattern(r.prefix(), pattern)+"/", http.StatusMovedPermanently)
+		}))
+	}
+
+	return r
+}
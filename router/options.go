@@ -0,0 +1,131 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/pb33f/libopenapi/datamodel/high/base"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	"github.com/pb33f/libopenapi/orderedmap"
+)
+
+// WithSerializers registers serializers under their content type, replacing
+// any serializer already registered for the same content type.
+func WithSerializers(serializers ...Serializer) Option {
+	return func(r *Router) {
+		for _, s := range serializers {
+			r.serializers[s.ContentType()] = s
+		}
+	}
+}
+
+// WithErrorProcessor replaces the processor converting errors returned by
+// handlers into their response representation.
+func WithErrorProcessor(errorProcessor ErrorProcessor) Option {
+	return func(r *Router) {
+		r.errorProcessor = errorProcessor
+	}
+}
+
+// WithErrorProcessors appends processors to the chain run, in order, on the
+// output of the router's ErrorProcessor.
+func WithErrorProcessors(errorProcessors ...ErrorProcessor) Option {
+	return func(r *Router) {
+		r.errorProcessors = append(r.errorProcessors, errorProcessors...)
+	}
+}
+
+func WithMethodToStatusCode(methodToStatusCode MethodToStatusCode) Option {
+	return func(r *Router) {
+		r.methodToStatusCode = methodToStatusCode
+	}
+}
+
+// WithContentType sets the content type used by routes whose output does not
+// implement Serializer. A serializer must be registered for it.
+func WithContentType(contentType string) Option {
+	return func(r *Router) {
+		r.contentType = contentType
+	}
+}
+
+// WithFormLimits limits the size of form request bodies. Up to maxMemory
+// bytes of a multipart form are kept in memory and up to maxDisk more bytes
+// of file parts are stored in temporary files. Larger bodies are rejected
+// with RequestEntityTooLargeError.
+func WithFormLimits(maxMemory, maxDisk int64) Option {
+	return func(r *Router) {
+		r.formMemory = maxMemory
+		r.formDisk = maxDisk
+	}
+}
+
+// WithWebSocketOrigin replaces the check of the Origin header of WebSocket
+// handshakes. By default, only requests without Origin or from the same host
+// are accepted.
+func WithWebSocketOrigin(check func(*http.Request) bool) Option {
+	return func(r *Router) {
+		r.checkOrigin = check
+	}
+}
+
+func WithAutoSlash(enable bool) Option {
+	return func(r *Router) {
+		r.enableAutoSlash = enable
+	}
+}
+
+// WithDebug enables development checks, such as warning when a handler
+// responds with a status code its route does not declare.
+func WithDebug(enable bool) Option {
+	return func(r *Router) {
+		r.debug = enable
+	}
+}
+
+// WithInfo sets the info object of the OpenAPI document. It has no effect on
+// routers returned by Group.
+func WithInfo(info *base.Info) Option {
+	return func(r *Router) {
+		if r.doc != nil {
+			r.doc.Info = info
+		}
+	}
+}
+
+// WithTypeSchema documents values of type T with the schema returned by
+// schema, instead of the one derived from the structure of T. The function
+// is called for every use of T, so that each use gets its own schema. It
+// replaces the built-in schemas of well-known types such as time.Time, and
+// has no effect on routers returned by Group.
+func WithTypeSchema[T any](schema func() *base.Schema) Option {
+	return func(r *Router) {
+		if r.typeSchemas != nil {
+			r.typeSchemas[reflect.TypeFor[T]()] = schema
+		}
+	}
+}
+
+// WithDocument replaces the base OpenAPI document that routes are added to.
+// Missing paths and components are initialized. It has no effect on routers
+// returned by Group.
+func WithDocument(doc *v3.Document) Option {
+	return func(r *Router) {
+		if r.doc == nil {
+			return
+		}
+		if doc.Paths == nil {
+			doc.Paths = &v3.Paths{}
+		}
+		if doc.Paths.PathItems == nil {
+			doc.Paths.PathItems = orderedmap.New[string, *v3.PathItem]()
+		}
+		if doc.Components == nil {
+			doc.Components = &v3.Components{}
+		}
+		if doc.Components.Schemas == nil {
+			doc.Components.Schemas = orderedmap.New[string, *base.SchemaProxy]()
+		}
+		r.doc = doc
+	}
+}
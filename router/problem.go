@@ -0,0 +1,182 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/pb33f/libopenapi/datamodel/high/base"
+)
+
+const (
+	contentTypeXml         = "application/xml"
+	contentTypeProblemJson = "application/problem+json"
+	contentTypeProblemXml  = "application/problem+xml"
+
+	problemNamespace = "urn:ietf:rfc:7807"
+)
+
+var (
+	_ json.Marshaler   = HTTPError{}
+	_ json.Unmarshaler = (*HTTPError)(nil)
+	_ xml.Marshaler    = HTTPError{}
+	_ SchemaProvider   = HTTPError{}
+)
+
+// problemMembers are the members of a problem details object that cannot be
+// overridden by extensions.
+var problemMembers = []string{"type", "title", "status", "detail", "instance", "errors"}
+
+type problem HTTPError
+
+func (e HTTPError) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(problem(e))
+	if err != nil || len(e.Extensions) == 0 {
+		return data, err
+	}
+
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	for _, key := range slices.Sorted(maps.Keys(e.Extensions)) {
+		if slices.Contains(problemMembers, key) {
+			continue
+		}
+
+		value, err := json.Marshal(e.Extensions[key])
+		if err != nil {
+			return nil, fmt.Errorf("extension %q: %w", key, err)
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// Schema returns no schema, so that the error is documented by its fields,
+// which MarshalJSON encodes along with the extensions.
+func (HTTPError) Schema() *base.Schema {
+	return nil
+}
+
+func (e *HTTPError) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*problem)(e)); err != nil {
+		return err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	e.Extensions = nil
+	for key, raw := range members {
+		if slices.Contains(problemMembers, key) {
+			continue
+		}
+
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if e.Extensions == nil {
+			e.Extensions = make(map[string]any)
+		}
+		e.Extensions[key] = value
+	}
+
+	return nil
+}
+
+// MarshalXML encodes the error in the XML format of RFC 9457. Extension
+// values are encoded as elements holding their textual representation.
+func (e HTTPError) MarshalXML(enc *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{Name: xml.Name{Local: "problem"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: problemNamespace},
+	}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	members := []struct {
+		name  string
+		value any
+		omit  bool
+	}{
+		{"type", e.Type, e.Type == ""},
+		{"title", e.Title, e.Title == ""},
+		{"status", e.Status, e.Status == 0},
+		{"detail", e.Detail, e.Detail == ""},
+		{"instance", e.Instance, e.Instance == ""},
+	}
+	for _, m := range members {
+		if m.omit {
+			continue
+		}
+		if err := enc.EncodeElement(m.value, xml.StartElement{Name: xml.Name{Local: m.name}}); err != nil {
+			return err
+		}
+	}
+
+	if len(e.Errors) > 0 {
+		items := struct {
+			Items []ErrorItem `xml:"i"`
+		}{e.Errors}
+		if err := enc.EncodeElement(items, xml.StartElement{Name: xml.Name{Local: "errors"}}); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(e.Extensions)) {
+		if slices.Contains(problemMembers, key) {
+			continue
+		}
+		value := fmt.Sprint(e.Extensions[key])
+		if err := enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// problemContentTypes returns the media types problem details can be
+// serialized to: JSON, and XML when an XML serializer is registered.
+func (r *Router) problemContentTypes() []string {
+	if _, ok := r.serializers[contentTypeXml]; ok {
+		return []string{contentTypeProblemJson, contentTypeProblemXml}
+	}
+	return []string{contentTypeProblemJson}
+}
+
+// problemSerializer selects the representation of a problem details response.
+// XML is used when the response would have been XML, or when the client asks
+// for it explicitly.
+func (r *Router) problemSerializer(ctx *ContextAny) (string, Serializer) {
+	offers := r.problemContentTypes()
+	if ctx.contentType == contentTypeXml {
+		slices.Reverse(offers)
+	}
+
+	// clients accepting application/xml do not match either problem type
+	contentType, ok := negotiate(ctx.Header(xAccept), offers)
+	if !ok && ctx.contentType == contentTypeXml {
+		contentType, ok = offers[0], true
+	}
+	if ok && contentType == contentTypeProblemXml {
+		return contentType, r.serializers[contentTypeXml]
+	}
+
+	if s, ok := r.serializers[contentTypeJson]; ok {
+		return contentTypeProblemJson, s
+	}
+	return contentTypeProblemJson, JSONSerializer{}
+}
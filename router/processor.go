@@ -0,0 +1,134 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+var (
+	_ ErrorProcessor = ChainErrorProcessors()
+	_ ErrorProcessor = LogErrors(nil)
+	_ ErrorProcessor = RedactInternalErrors()
+	_ ErrorProcessor = StackTraces()
+)
+
+// ChainErrorProcessors returns a processor running processors in order, each
+// one receiving the output of the previous one.
+func ChainErrorProcessors(processors ...ErrorProcessor) ErrorProcessor {
+	return func(err error) error {
+		for _, process := range processors {
+			err = process(err)
+		}
+		return err
+	}
+}
+
+// LogErrors logs errors with logger, or with slog.Default when it is nil.
+// Server errors are logged at error level and client errors at info level.
+// It should run after the processor converting errors to HTTPError.
+func LogErrors(logger *slog.Logger) ErrorProcessor {
+	return func(err error) error {
+		l := logger
+		if l == nil {
+			l = slog.Default()
+		}
+
+		status := http.StatusInternalServerError
+		var errorStatus Error
+		if errors.As(err, &errorStatus) {
+			status = errorStatus.StatusCode()
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{slog.Int("status", status), slog.String("error", err.Error())}
+		var httpErr HTTPError
+		if errors.As(err, &httpErr) && httpErr.Err != nil {
+			attrs = append(attrs, slog.String("cause", httpErr.Err.Error()))
+		}
+
+		l.LogAttrs(context.Background(), level, "router: request failed", attrs...)
+		return err
+	}
+}
+
+// RedactInternalErrors removes the detail, error items and extensions of
+// server errors, so that internal messages do not leak to clients in
+// production. The original error stays available through HTTPError.Err.
+func RedactInternalErrors() ErrorProcessor {
+	return func(err error) error {
+		httpErr, ok := err.(HTTPError)
+		if !ok || httpErr.StatusCode() < http.StatusInternalServerError {
+			return err
+		}
+
+		httpErr.Title = http.StatusText(httpErr.StatusCode())
+		httpErr.Detail = "An unexpected error occurred"
+		httpErr.Errors = nil
+		httpErr.Extensions = nil
+		return httpErr
+	}
+}
+
+// StackTraces adds the stack of recovered panics to server error responses,
+// as the "stack" extension member. Stacks are only recorded by routers with
+// WithDebug enabled, so it has no effect in production.
+func StackTraces() ErrorProcessor {
+	return func(err error) error {
+		httpErr, ok := err.(HTTPError)
+		if !ok || httpErr.StatusCode() < http.StatusInternalServerError {
+			return err
+		}
+
+		var panicErr *panicError
+		if !errors.As(err, &panicErr) || panicErr.stack == nil {
+			return err
+		}
+
+		var stack []string
+		for _, line := range strings.Split(string(panicErr.stack), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				stack = append(stack, line)
+			}
+		}
+
+		httpErr.Extensions = maps.Clone(httpErr.Extensions)
+		if httpErr.Extensions == nil {
+			httpErr.Extensions = make(map[string]any)
+		}
+		httpErr.Extensions["stack"] = stack
+		return httpErr
+	}
+}
+
+// panicError is a panic recovered by a route, with the stack it was raised
+// from.
+type panicError struct {
+	err   error
+	stack []byte
+}
+
+func (e *panicError) Error() string { return e.err.Error() }
+func (e *panicError) Unwrap() error { return e.err }
+
+// recovered converts a value recovered from a panic to an error. In debug
+// mode, it records the stack of the panic for StackTraces.
+func (r *Router) recovered(v any) error {
+	err, ok := v.(error)
+	if !ok {
+		err = fmt.Errorf("panic recovered: %v", v)
+	}
+	if r.debug {
+		return &panicError{err: err, stack: debug.Stack()}
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package router
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+var (
+	_ http.ResponseWriter = (*responseWriter)(nil)
+	_ http.Flusher        = (*responseWriter)(nil)
+	_ http.Hijacker       = (*responseWriter)(nil)
+)
+
+// responseWriter defers sending the status line and headers until the body
+// is first written or flushed, so that they can still be changed after the
+// handler returns. It supports http.ResponseController through Unwrap.
+type responseWriter struct {
+	http.ResponseWriter
+	status    int
+	written   int64
+	committed bool
+}
+
+func newResponseWriter(res http.ResponseWriter, status int) *responseWriter {
+	return &responseWriter{ResponseWriter: res, status: status}
+}
+
+// WriteHeader records the status code to send. Informational status codes
+// are sent immediately, as they do not commit the response.
+func (w *responseWriter) WriteHeader(code int) {
+	if w.committed {
+		return
+	}
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.commit()
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *responseWriter) FlushError() error {
+	w.commit()
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.committed = true
+	}
+	return conn, rw, err
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// commit sends the status line and headers if they have not been sent yet.
+func (w *responseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
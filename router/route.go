@@ -2,11 +2,20 @@ package router
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
+	"math"
 	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/gobeam/stringy"
+	"github.com/pb33f/libopenapi/datamodel/high/base"
 	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	"github.com/pb33f/libopenapi/orderedmap"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -27,6 +36,21 @@ type Route interface {
 	Method() string
 	Pattern() string
 	MuxPattern() string
+	Consumes(contentTypes ...string) Route
+
+	OperationID(id string) Route
+	Summary(summary string) Route
+	Description(description string) Route
+	Tags(tags ...string) Route
+	Deprecated() Route
+	Status(code int) Route
+	Response(code int, description string, body any) Route
+	ExternalDocs(url, description string) Route
+	Extension(name string, value any) Route
+	Errors(errs ...Error) Route
+	ErrorProcessors(errorProcessors ...ErrorProcessor) Route
+
+	mount(prefix string, middlewares []Middleware)
 }
 
 type route[Input, Output any, Ctx ctx[Input]] struct {
@@ -36,14 +60,31 @@ type route[Input, Output any, Ctx ctx[Input]] struct {
 	handler     Handler[Input, Output, Ctx]
 	router      *Router
 
-	contentType    string
-	serializer     Serializer
-	errorProcessor ErrorProcessor
+	contentType     string
+	serializer      Serializer
+	consumes        []string
+	produces        []string
+	errorProcessor  ErrorProcessor
+	errorProcessors []ErrorProcessor
+	stream          reflect.Type // element type of iterator outputs
+
+	operationId  string
+	summary      string
+	description  string
+	statusCode   int
+	tags         []string
+	deprecated   bool
+	responses    []response
+	errors       []Error
+	externalDocs *base.ExternalDoc
+	extensions   *orderedmap.Map[string, *yaml.Node]
+}
 
-	operationId string
-	summary     string
+// response is an additional response documented for a route.
+type response struct {
+	code        int
 	description string
-	statusCode  int
+	body        reflect.Type
 }
 
 func newRoute[Input, Output any, Ctx ctx[Input]](
@@ -52,11 +93,11 @@ func newRoute[Input, Output any, Ctx ctx[Input]](
 	pattern string,
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
-	if router.pattern != "" {
+	if prefix := router.prefix(); prefix != "" {
 		if pattern != "/" {
-			pattern = router.pattern + pattern
+			pattern = prefix + pattern
 		} else {
-			pattern = router.pattern
+			pattern = prefix
 		}
 	}
 
@@ -81,6 +122,35 @@ func newRoute[Input, Output any, Ctx ctx[Input]](
 		contentType = contentTypeJson
 	}
 
+	produces := []string{contentType}
+	if _, ok := any(output).(Serializer); !ok {
+		for _, ct := range slices.Sorted(maps.Keys(router.serializers)) {
+			if ct != contentType {
+				produces = append(produces, ct)
+			}
+		}
+	}
+
+	// iterators are streamed with their own encoders
+	stream := streamElem(reflect.TypeOf((*Output)(nil)).Elem())
+	if stream != nil {
+		serializer = JSONSerializer{}
+		produces = streamContentTypes(stream)
+		contentType = produces[0]
+	}
+
+	consumes := []string{contentTypeJson}
+	if _, ok := router.serializers[router.contentType]; ok {
+		consumes = []string{router.contentType}
+	}
+
+	// invalid validate tags panic here rather than on the first request
+	checkRules(reflect.TypeOf((*Input)(nil)).Elem())
+
+	if formTypes := formContentTypes(reflect.TypeOf((*Input)(nil)).Elem()); formTypes != nil {
+		consumes = formTypes
+	}
+
 	errorProcessor := router.errorProcessor
 	if errorProcessor == nil {
 		errorProcessor = defaultErrorProcessor
@@ -97,11 +167,15 @@ func newRoute[Input, Output any, Ctx ctx[Input]](
 		pattern:     pattern,
 		handler:     handler,
 		router:      router,
-		middlewares: router.middlewares,
+		middlewares: router.chain(),
 
-		serializer:     serializer,
-		contentType:    contentType,
-		errorProcessor: errorProcessor,
+		serializer:      serializer,
+		contentType:     contentType,
+		consumes:        consumes,
+		produces:        produces,
+		errorProcessor:  errorProcessor,
+		errorProcessors: slices.Clone(router.errorProcessors),
+		stream:          stream,
 
 		summary:     summary,
 		description: description,
@@ -112,41 +186,112 @@ func newRoute[Input, Output any, Ctx ctx[Input]](
 
 func (r *route[Input, Output, Ctx]) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	ctxAny := &ContextAny{
-		req:          req,
-		res:          res,
-		statusCode:   r.statusCode,
-		isNextCalled: true,
+		req:         req,
+		res:         newResponseWriter(res, r.statusCode),
+		serializers: r.router.serializers,
+		consumes:    r.consumes,
+		formMemory:  r.router.formMemory,
+		formDisk:    r.router.formDisk,
 	}
 
 	ctx := newContext[Input, Ctx](ctxAny)
 
 	defer func() {
-		if err := recover(); err != nil {
-			if e, ok := err.(error); ok {
-				r.handleError(ctx, e)
-			} else {
-				r.handleError(ctx, fmt.Errorf("panic recovered: %v", err))
-			}
+		if v := recover(); v != nil {
+			r.handleError(ctxAny, r.router.recovered(v))
 		}
 	}()
 
-	for _, middleware := range r.middlewares {
-		ctxAny.isNextCalled = false
-		if err := middleware(ctxAny); err != nil || !ctxAny.isNextCalled {
-			r.handleError(ctx, err)
-			return
-		}
+	if err := r.negotiate(ctxAny); err != nil {
+		r.handleError(ctxAny, err)
+		return
+	}
+
+	if err := r.next(ctxAny, ctx, 0)(); err != nil {
+		r.handleError(ctxAny, err)
+		return
+	}
+
+	if r.router.debug && !r.declares(ctxAny.Status()) {
+		slog.Warn("router: handler responded with an undeclared status",
+			"route", r.MuxPattern(), "status", ctxAny.Status())
+	}
+
+	// the handler wrote the response itself
+	if ctxAny.res.committed {
+		return
+	}
+
+	// a middleware stopped the request without setting an output
+	if !ctxAny.hasOutput {
+		ctxAny.res.commit()
+		return
 	}
 
-	output, err := r.handler(ctx)
-	if err != nil {
-		r.handleError(ctx, err)
+	if r.stream != nil {
+		r.writeStream(ctxAny)
 		return
 	}
 
-	ctx.ResponseWriter().WriteHeader(ctxAny.statusCode)
-	ctx.SetHeader(xContentType, r.contentType)
-	_ = r.serializer.Marshal(ctx.ResponseWriter(), output)
+	ctx.SetHeader(xContentType, ctxAny.contentType)
+	if err := ctxAny.serializer.Marshal(ctxAny.res, ctxAny.output); err != nil && !ctxAny.res.committed {
+		r.handleError(ctxAny, err)
+		return
+	}
+	ctxAny.res.commit()
+}
+
+// next returns the function run by ContextAny.Next from the middleware at
+// index i - 1: it runs the middleware at index i, or the handler once every
+// middleware has been entered. Calling it again returns the first result.
+func (r *route[Input, Output, Ctx]) next(ctxAny *ContextAny, ctx Ctx, i int) func() error {
+	var called bool
+	var err error
+	return func() error {
+		if called {
+			return err
+		}
+		called = true
+
+		if i == len(r.middlewares) {
+			var output Output
+			output, err = r.handler(ctx)
+			ctxAny.SetOutput(output)
+			return err
+		}
+
+		prev := ctxAny.next
+		ctxAny.next = r.next(ctxAny, ctx, i+1)
+		err = r.middlewares[i](ctxAny)
+		ctxAny.next = prev
+		return err
+	}
+}
+
+// negotiate selects the response serializer from the Accept header of the
+// request. Until it succeeds, responses use the route's default serializer.
+func (r *route[Input, Output, Ctx]) negotiate(ctx *ContextAny) error {
+	ctx.contentType, ctx.serializer = r.contentType, r.serializer
+	if len(r.produces) > 1 {
+		ctx.AddHeader("Vary", xAccept)
+	}
+
+	accept := ctx.Header(xAccept)
+	contentType, ok := negotiate(accept, r.produces)
+	if !ok {
+		return NotAcceptableError{
+			Err:    fmt.Errorf("no acceptable content type for %q", accept),
+			Detail: fmt.Sprintf("Cannot produce a response matching %q, available content types: %s", accept, strings.Join(r.produces, ", ")),
+		}
+	}
+
+	if contentType != r.contentType {
+		ctx.contentType = contentType
+		if serializer, ok := r.router.serializers[contentType]; ok {
+			ctx.serializer = serializer
+		}
+	}
+	return nil
 }
 
 func (r *route[Input, Output, Ctx]) Use(middlewares ...Middleware) Route {
@@ -154,6 +299,121 @@ func (r *route[Input, Output, Ctx]) Use(middlewares ...Middleware) Route {
 	return r
 }
 
+// Consumes sets the media types accepted for the request body. Each of them
+// must have a serializer registered on the router.
+func (r *route[Input, Output, Ctx]) Consumes(contentTypes ...string) Route {
+	r.consumes = contentTypes
+	return r
+}
+
+func (r *route[Input, Output, Ctx]) OperationID(id string) Route {
+	r.operationId = id
+	return r
+}
+
+func (r *route[Input, Output, Ctx]) Summary(summary string) Route {
+	r.summary = summary
+	return r
+}
+
+func (r *route[Input, Output, Ctx]) Description(description string) Route {
+	r.description = description
+	return r
+}
+
+func (r *route[Input, Output, Ctx]) Tags(tags ...string) Route {
+	r.tags = append(r.tags, tags...)
+	return r
+}
+
+func (r *route[Input, Output, Ctx]) Deprecated() Route {
+	r.deprecated = true
+	return r
+}
+
+// Status sets the status code of successful responses, which defaults to
+// the one returned by the router's MethodToStatusCode.
+func (r *route[Input, Output, Ctx]) Status(code int) Route {
+	r.statusCode = code
+	return r
+}
+
+// Response documents an additional response. The schema of its content is
+// derived from the type of body; a nil body documents a response without
+// content.
+func (r *route[Input, Output, Ctx]) Response(code int, description string, body any) Route {
+	res := response{code: code, description: description}
+	if body != nil {
+		res.body = reflect.TypeOf(body)
+	}
+	r.responses = append(r.responses, res)
+	return r
+}
+
+func (r *route[Input, Output, Ctx]) ExternalDocs(url, description string) Route {
+	r.externalDocs = &base.ExternalDoc{URL: url, Description: description}
+	return r
+}
+
+// Extension adds a vendor extension to the operation. The x- prefix is added
+// to name when missing.
+func (r *route[Input, Output, Ctx]) Extension(name string, value any) Route {
+	if !strings.HasPrefix(name, "x-") {
+		name = "x-" + name
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		panic(fmt.Sprintf("router: invalid value for extension %s: %v", name, err))
+	}
+
+	if r.extensions == nil {
+		r.extensions = orderedmap.New[string, *yaml.Node]()
+	}
+	r.extensions.Set(name, node)
+	return r
+}
+
+// Errors declares the errors the handler may return. Each status code gets
+// its own response in the operation, with the errors as examples.
+func (r *route[Input, Output, Ctx]) Errors(errs ...Error) Route {
+	r.errors = append(r.errors, errs...)
+	return r
+}
+
+// ErrorProcessors appends processors to the chain run on the output of the
+// router's ErrorProcessor, after those inherited from the router.
+func (r *route[Input, Output, Ctx]) ErrorProcessors(errorProcessors ...ErrorProcessor) Route {
+	r.errorProcessors = append(r.errorProcessors, errorProcessors...)
+	return r
+}
+
+func (r *route[Input, Output, Ctx]) processError(err error) error {
+	err = r.errorProcessor(err)
+	for _, process := range r.errorProcessors {
+		err = process(err)
+	}
+	return err
+}
+
+// declares reports whether code is documented as a response of the route.
+func (r *route[Input, Output, Ctx]) declares(code int) bool {
+	if code == r.statusCode {
+		return true
+	}
+	for _, res := range r.responses {
+		if res.code == code {
+			return true
+		}
+	}
+	for _, err := range r.errors {
+		if err.StatusCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *route[Input, Output, Ctx]) Method() string {
 	return r.method
 }
@@ -169,17 +429,48 @@ func (r *route[Input, Output, Ctx]) MuxPattern() string {
 	return r.method + " " + r.pattern
 }
 
-func (r *route[Input, Output, Ctx]) handleError(ctx Ctx, err error) {
+func (r *route[Input, Output, Ctx]) mount(prefix string, middlewares []Middleware) {
+	r.pattern = joinPattern(prefix, r.pattern)
+	if r.pattern == "" {
+		r.pattern = "/"
+	}
+	r.middlewares = append(slices.Clone(middlewares), r.middlewares...)
+}
+
+func (r *route[Input, Output, Ctx]) handleError(ctx *ContextAny, err error) {
 	statusCode := http.StatusInternalServerError
-	err = r.router.errorProcessor(err)
+	err = r.processError(err)
 	if v, ok := err.(Error); ok {
 		statusCode = v.StatusCode()
 	}
 
-	res := ctx.ResponseWriter()
-	res.WriteHeader(statusCode)
-	ctx.SetHeader(xContentType, r.contentType)
-	_ = r.serializer.Marshal(res, err)
+	if r.router.debug && !r.declares(statusCode) {
+		slog.Warn("router: handler returned an undeclared error status",
+			"route", r.MuxPattern(), "status", statusCode, "error", err)
+	}
+
+	contentType, serializer := ctx.contentType, ctx.serializer
+	if problem, ok := err.(HTTPError); ok {
+		if problem.Instance == "" {
+			problem.Instance = ctx.Request().URL.Path
+			err = problem
+		}
+		if problem.RetryAfter > 0 {
+			seconds := int64(math.Ceil(problem.RetryAfter.Seconds()))
+			ctx.SetHeader("Retry-After", strconv.FormatInt(seconds, 10))
+		}
+		contentType, serializer = r.router.problemSerializer(ctx)
+	}
+
+	// the error happened after the response was sent, it can only be logged
+	if ctx.res.committed {
+		return
+	}
+
+	ctx.SetStatus(statusCode)
+	ctx.SetHeader(xContentType, contentType)
+	_ = serializer.Marshal(ctx.res, err)
+	ctx.res.commit()
 }
 
 type MethodToStatusCode func(string) int
@@ -1,29 +1,47 @@
 package router
 
 import (
+	"maps"
 	"net/http"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
 
+	"github.com/pb33f/libopenapi/datamodel/high/base"
 	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
 )
 
 var _ http.Handler = (*Router)(nil)
 
 type Router struct {
-	once sync.Once
+	once   sync.Once
+	parent *Router
 
 	mux         *http.ServeMux
 	pattern     string
 	middlewares []Middleware
 	routes      []Route
+	handlers    []handler
 
 	doc                *v3.Document
+	typeSchemas        map[reflect.Type]func() *base.Schema
 	serializers        map[string]Serializer
 	errorProcessor     ErrorProcessor
+	errorProcessors    []ErrorProcessor
 	methodToStatusCode MethodToStatusCode
 	contentType        string
+	formMemory         int64
+	formDisk           int64
+	checkOrigin        func(*http.Request) bool
 
 	enableAutoSlash bool
+	debug           bool
+}
+
+type handler struct {
+	pattern string
+	http.Handler
 }
 
 type (
@@ -32,8 +50,8 @@ type (
 	Handler[I, O any, Ctx ctx[I]] func(Ctx) (O, error)
 )
 
-func New() *Router {
-	return &Router{
+func New(opts ...Option) *Router {
+	r := &Router{
 		once: sync.Once{},
 
 		pattern:     "",
@@ -42,26 +60,156 @@ func New() *Router {
 		routes:      make([]Route, 0),
 
 		doc:                defaultSchema(),
+		typeSchemas:        defaultTypeSchemas(),
 		serializers:        defaultSerializers(),
 		contentType:        contentTypeJson,
 		errorProcessor:     defaultErrorProcessor,
 		methodToStatusCode: defaultMethodToStatusCode,
+		formMemory:         defaultFormMemory,
+		formDisk:           defaultFormDisk,
+		checkOrigin:        sameOrigin,
 
 		enableAutoSlash: false,
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Group returns a child router whose routes are registered under pattern.
+// The child inherits the settings of r, and shares its mux and OpenAPI
+// document. Its prefix and the middlewares of its parents are resolved when a
+// route is registered, so they follow a later Mount of r.
+func (r *Router) Group(pattern string, opts ...Option) *Router {
+	g := &Router{
+		parent: r,
+
+		pattern:     joinPattern("", pattern),
+		middlewares: make([]Middleware, 0),
+
+		serializers:        maps.Clone(r.serializers),
+		contentType:        r.contentType,
+		errorProcessor:     r.errorProcessor,
+		errorProcessors:    slices.Clone(r.errorProcessors),
+		methodToStatusCode: r.methodToStatusCode,
+		formMemory:         r.formMemory,
+		formDisk:           r.formDisk,
+		checkOrigin:        r.checkOrigin,
+
+		enableAutoSlash: r.enableAutoSlash,
+		debug:           r.debug,
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+// Mount attaches a router created with New under pattern. Its routes and
+// handlers, including those of its groups and any registered afterwards, are
+// served by r and documented in r's schema. The middlewares of r run before
+// those of the mounted router.
+func (r *Router) Mount(pattern string, child *Router) *Router {
+	if child.parent != nil {
+		panic("router: cannot mount a router that is already mounted or grouped")
+	}
+
+	prefix := joinPattern(r.prefix(), pattern)
+	middlewares := r.chain()
+
+	child.parent = r
+	child.pattern = joinPattern(pattern, child.pattern)
+
+	// the mounted routes are documented with the type schemas of the root
+	root := r.root()
+	for t, schema := range child.typeSchemas {
+		if _, ok := root.typeSchemas[t]; !ok {
+			root.typeSchemas[t] = schema
+		}
+	}
+	for _, ro := range child.routes {
+		ro.mount(prefix, middlewares)
+		root.routes = append(root.routes, ro)
+	}
+	for _, h := range child.handlers {
+		h.pattern = prefixPattern(prefix, h.pattern)
+		root.handlers = append(root.handlers, h)
+	}
+	child.routes, child.handlers = nil, nil
+
+	return child
+}
+
+// Handle registers a plain http.Handler under pattern, which may start with a
+// method as accepted by http.ServeMux. Middlewares do not apply to it and it is
+// not part of the schema.
+func (r *Router) Handle(pattern string, h http.Handler) *Router {
+	root := r.root()
+	root.handlers = append(root.handlers, handler{pattern: prefixPattern(r.prefix(), pattern), Handler: h})
+	return r
+}
+
+func (r *Router) Use(middlewares ...Middleware) *Router {
+	r.middlewares = append(r.middlewares, middlewares...)
+	return r
+}
+
+func (r *Router) root() *Router {
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
+// prefix returns the pattern of r joined to those of its parents.
+func (r *Router) prefix() string {
+	if r.parent == nil {
+		return r.pattern
+	}
+	return joinPattern(r.parent.prefix(), r.pattern)
+}
+
+// chain returns the middlewares of the parents of r followed by its own.
+func (r *Router) chain() []Middleware {
+	if r.parent == nil {
+		return slices.Clone(r.middlewares)
+	}
+	return append(r.parent.chain(), r.middlewares...)
+}
+
+func (r *Router) addRoute(ro Route) {
+	root := r.root()
+	root.routes = append(root.routes, ro)
 }
 
 func (r *Router) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if r.parent != nil {
+		r.root().ServeHTTP(res, req)
+		return
+	}
+
 	r.once.Do(func() {
 		for _, ro := range r.routes {
 			r.mux.Handle(ro.MuxPattern(), ro)
 		}
+		for _, h := range r.handlers {
+			r.mux.Handle(h.pattern, h)
+		}
 	})
 
 	r.mux.ServeHTTP(res, req)
 }
 
 func (r *Router) Schema() *v3.Document {
+	if r.parent != nil {
+		return r.root().Schema()
+	}
+
 	for _, ro := range r.routes {
 		item, ok := r.doc.Paths.PathItems.Get(ro.Pattern())
 		if !ok {
@@ -97,7 +245,7 @@ func Get[Input, Output any, Ctx ctx[Input]](
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
 	route := newRoute(r, http.MethodGet, pattern, handler)
-	r.routes = append(r.routes, route)
+	r.addRoute(route)
 	return route
 }
 
@@ -107,7 +255,7 @@ func Head[Input, Output any, Ctx ctx[Input]](
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
 	route := newRoute(r, http.MethodHead, pattern, handler)
-	r.routes = append(r.routes, route)
+	r.addRoute(route)
 	return route
 }
 
@@ -117,7 +265,7 @@ func Post[Input, Output any, Ctx ctx[Input]](
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
 	route := newRoute(r, http.MethodPost, pattern, handler)
-	r.routes = append(r.routes, route)
+	r.addRoute(route)
 	return route
 }
 
@@ -127,7 +275,7 @@ func Put[Input, Output any, Ctx ctx[Input]](
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
 	route := newRoute(r, http.MethodPut, pattern, handler)
-	r.routes = append(r.routes, route)
+	r.addRoute(route)
 	return route
 }
 
@@ -137,7 +285,7 @@ func Patch[Input, Output any, Ctx ctx[Input]](
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
 	route := newRoute(r, http.MethodPatch, pattern, handler)
-	r.routes = append(r.routes, route)
+	r.addRoute(route)
 	return route
 }
 
@@ -147,7 +295,7 @@ func Delete[Input, Output any, Ctx ctx[Input]](
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
 	route := newRoute(r, http.MethodDelete, pattern, handler)
-	r.routes = append(r.routes, route)
+	r.addRoute(route)
 	return route
 }
 
@@ -157,6 +305,34 @@ func Any[Input, Output any, Ctx ctx[Input]](
 	handler Handler[Input, Output, Ctx],
 ) *route[Input, Output, Ctx] {
 	route := newRoute(r, "", pattern, handler)
-	r.routes = append(r.routes, route)
+	r.addRoute(route)
 	return route
 }
+
+// prefixPattern joins prefix to the path of a mux pattern, keeping its method.
+func prefixPattern(prefix, pattern string) string {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	}
+
+	path = joinPattern(prefix, path)
+	if path == "" {
+		path = "/"
+	}
+	if method != "" {
+		path = method + " " + path
+	}
+	return path
+}
+
+func joinPattern(prefix, pattern string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if pattern == "" || pattern == "/" {
+		return prefix
+	}
+	if pattern[0] != '/' {
+		pattern = "/" + pattern
+	}
+	return prefix + pattern
+}
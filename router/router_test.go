@@ -1,11 +1,31 @@
 package router_test
 
 import (
+	"bufio"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"math"
+	"math/big"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pb33f/libopenapi/datamodel/high/base"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
 	"go.grass.garden/router"
 )
 
@@ -54,3 +74,1902 @@ func serveMux() *http.ServeMux {
 	})
 	return mux
 }
+
+func TestGroup(t *testing.T) {
+	var calls []string
+	trace := func(name string) router.Middleware {
+		return func(ctx *router.ContextAny) error {
+			calls = append(calls, name)
+			return ctx.Next()
+		}
+	}
+
+	r := router.New().Use(trace("root"))
+	v1 := r.Group("/v1").Use(trace("v1"))
+	users := v1.Group("/users").Use(trace("users"))
+	router.Get(users, "/{id}", func(ctx *router.ContextAny) (string, error) {
+		return ctx.PathParam("id"), nil
+	})
+
+	orders := router.New().Use(trace("orders"))
+	router.Get(orders, "/", func(*router.ContextAny) (string, error) {
+		return "orders", nil
+	})
+	v1.Mount("/orders", orders)
+
+	for _, tc := range []struct {
+		path  string
+		body  string
+		calls []string
+	}{
+		{"/v1/users/42", "\"42\"\n", []string{"root", "v1", "users"}},
+		{"/v1/orders", "\"orders\"\n", []string{"root", "v1", "orders"}},
+	} {
+		calls = nil
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if res.Body.String() != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.path, res.Body.String(), tc.body)
+		}
+		if !slices.Equal(calls, tc.calls) {
+			t.Errorf("%s: middlewares = %v, want %v", tc.path, calls, tc.calls)
+		}
+	}
+
+	paths := r.Schema().Paths.PathItems
+	for _, p := range []string{"/v1/users/{id}", "/v1/orders"} {
+		if _, ok := paths.Get(p); !ok {
+			t.Errorf("schema is missing path %s", p)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	var calls []string
+	trace := func(name string) router.Middleware {
+		return func(ctx *router.ContextAny) error {
+			calls = append(calls, name)
+			return ctx.Next()
+		}
+	}
+
+	r := router.New().Use(trace("root"))
+	child := router.New().Use(trace("child"))
+	child.OpenAPI("").Docs("/docs")
+	child.Handle("GET /ping", http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		_, _ = res.Write([]byte("pong"))
+	}))
+	g := child.Group("/g").Use(trace("g"))
+	router.Get(g, "/early", func(*router.ContextAny) (string, error) {
+		return "early", nil
+	})
+
+	r.Mount("/v1", child)
+	router.Get(g, "/late", func(*router.ContextAny) (string, error) {
+		return "late", nil
+	})
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		body   string
+		calls  []string
+	}{
+		{"/v1/g/early", http.StatusOK, "\"early\"\n", []string{"root", "child", "g"}},
+		{"/v1/g/late", http.StatusOK, "\"late\"\n", []string{"root", "child", "g"}},
+		{"/g/late", http.StatusNotFound, "", nil},
+		{"/v1/ping", http.StatusOK, "pong", nil},
+		{"/v1/openapi.json", http.StatusOK, "", nil},
+		{"/v1/docs", http.StatusMovedPermanently, "", nil},
+		{"/v1/docs/", http.StatusOK, "", nil},
+		{"/v1/docs/assets/docs.js", http.StatusOK, "", nil},
+	} {
+		calls = nil
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if res.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.path, res.Code, tc.status)
+		}
+		if tc.body != "" && res.Body.String() != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.path, res.Body.String(), tc.body)
+		}
+		if !slices.Equal(calls, tc.calls) {
+			t.Errorf("%s: middlewares = %v, want %v", tc.path, calls, tc.calls)
+		}
+		if tc.path == "/v1/docs" && res.Header().Get("Location") != "/v1/docs/" {
+			t.Errorf("%s: location = %q", tc.path, res.Header().Get("Location"))
+		}
+	}
+
+	paths := r.Schema().Paths.PathItems
+	for _, p := range []string{"/v1/g/early", "/v1/g/late"} {
+		if _, ok := paths.Get(p); !ok {
+			t.Errorf("schema is missing path %s", p)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	type output struct {
+		Name string `json:"name" xml:"name"`
+	}
+	handler := func(*router.ContextAny) (output, error) { return output{Name: "ada"}, nil }
+
+	serve := func(r *router.Router, method, path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Run("WithSerializers", func(t *testing.T) {
+		r := router.New(router.WithSerializers(router.XMLSerializer{}))
+		router.Get(r, "/", handler)
+
+		res := serve(r, http.MethodGet, "/", "application/xml")
+		if ct := res.Header().Get("Content-Type"); ct != "application/xml" {
+			t.Errorf("content type = %q, want application/xml", ct)
+		}
+		if !strings.Contains(res.Body.String(), "<name>ada</name>") {
+			t.Errorf("body = %q, want an XML document", res.Body.String())
+		}
+	})
+
+	t.Run("WithMethodToStatusCode", func(t *testing.T) {
+		r := router.New(router.WithMethodToStatusCode(func(string) int { return http.StatusNoContent }))
+		router.Post(r, "/", handler)
+
+		if res := serve(r, http.MethodPost, "/", ""); res.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want %d", res.Code, http.StatusNoContent)
+		}
+	})
+
+	t.Run("WithContentType", func(t *testing.T) {
+		r := router.New(router.WithSerializers(router.XMLSerializer{}), router.WithContentType("application/xml"))
+		router.Get(r, "/", handler)
+
+		if ct := serve(r, http.MethodGet, "/", "").Header().Get("Content-Type"); ct != "application/xml" {
+			t.Errorf("content type = %q, want application/xml", ct)
+		}
+	})
+
+	t.Run("WithContentType without serializer", func(t *testing.T) {
+		r := router.New(router.WithContentType("application/xml"))
+		router.Get(r, "/", handler)
+
+		res := serve(r, http.MethodGet, "/", "")
+		if ct := res.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("content type = %q, want application/json", ct)
+		}
+		if res.Body.String() != "{\"name\":\"ada\"}\n" {
+			t.Errorf("body = %q, want the JSON encoding", res.Body.String())
+		}
+	})
+
+	t.Run("WithAutoSlash", func(t *testing.T) {
+		r := router.New(router.WithAutoSlash(true))
+		router.Get(r, "/items", handler)
+
+		if res := serve(r, http.MethodGet, "/items/", ""); res.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", res.Code, http.StatusOK)
+		}
+		if _, ok := r.Schema().Paths.PathItems.Get("/items/"); !ok {
+			t.Error("schema is missing path /items/")
+		}
+	})
+
+	t.Run("WithInfo", func(t *testing.T) {
+		r := router.New(router.WithInfo(&base.Info{Title: "Pets", Version: "2.0.0"}))
+		router.Get(r, "/", handler)
+
+		if info := r.Schema().Info; info.Title != "Pets" || info.Version != "2.0.0" {
+			t.Errorf("info = %+v, want Pets 2.0.0", info)
+		}
+	})
+
+	t.Run("WithDocument", func(t *testing.T) {
+		doc := &v3.Document{Version: "3.1.0", Info: &base.Info{Title: "Base"}}
+		r := router.New(router.WithDocument(doc))
+		router.Get(r, "/pets", handler)
+
+		if got := r.Schema(); got != doc || got.Info.Title != "Base" {
+			t.Errorf("schema = %p, want the base document %p", got, doc)
+		}
+		if _, ok := doc.Paths.PathItems.Get("/pets"); !ok {
+			t.Error("base document is missing path /pets")
+		}
+		if doc.Components.Schemas.Len() == 0 {
+			t.Error("base document has no component schemas")
+		}
+	})
+}
+
+func TestBindParams(t *testing.T) {
+	type input struct {
+		ID      int       `path:"id"`
+		Tags    []string  `query:"tag"`
+		Limit   *uint8    `query:"limit"`
+		Since   time.Time `query:"since"`
+		Verbose bool      `header:"X-Verbose"`
+		Session string    `cookie:"session"`
+	}
+
+	r := router.New()
+	router.Get(r, "/items/{id}", func(ctx *router.Context[input]) (input, error) {
+		return ctx.GetBody()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/7?tag=a&tag=b&limit=10&since=2024-01-02T03:04:05Z", nil)
+	req.Header.Set("X-Verbose", "true")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	var got input
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := input{
+		ID:      7,
+		Tags:    []string{"a", "b"},
+		Since:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Verbose: true,
+		Session: "abc",
+	}
+	if got.Limit == nil || *got.Limit != 10 {
+		t.Errorf("limit = %v, want 10", got.Limit)
+	}
+	got.Limit = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %+v, want %+v", got, want)
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/items/x?limit=300", nil))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", res.Code, http.StatusBadRequest)
+	}
+	var httpErr router.HTTPError
+	if err := json.NewDecoder(res.Body).Decode(&httpErr); err != nil {
+		t.Fatal(err)
+	}
+	if len(httpErr.Errors) != 2 || httpErr.Errors[0].Name != "id" || httpErr.Errors[1].Name != "limit" {
+		t.Errorf("errors = %+v, want items for id and limit", httpErr.Errors)
+	}
+
+	// only slices are split on commas
+	type file struct {
+		Name   string   `path:"name"`
+		Author string   `header:"X-Author" deprecated:"1"`
+		Langs  []string `header:"X-Langs"`
+	}
+	r = router.New()
+	router.Get(r, "/files/{name}", func(ctx *router.Context[file]) (file, error) {
+		return ctx.GetBody()
+	})
+	router.Head(r, "/files/{name}", func(ctx *router.Context[file]) (file, error) {
+		return ctx.GetBody()
+	})
+
+	req = httptest.NewRequest(http.MethodGet, "/files/a,b.txt", nil)
+	req.Header.Set("X-Author", "Doe, John")
+	req.Header.Set("X-Langs", "en, fr")
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	var f file
+	if err := json.NewDecoder(res.Body).Decode(&f); err != nil {
+		t.Fatal(err)
+	}
+	if want := (file{Name: "a,b.txt", Author: "Doe, John", Langs: []string{"en", "fr"}}); !reflect.DeepEqual(f, want) {
+		t.Errorf("body = %+v, want %+v", f, want)
+	}
+
+	// parameters are documented for every route sharing an input type, on
+	// every call
+	for range 2 {
+		item, _ := r.Schema().Paths.PathItems.Get("/files/{name}")
+		for _, op := range []*v3.Operation{item.Get, item.Head} {
+			if len(op.Parameters) != 3 {
+				t.Errorf("%s: %d parameters, want 3", op.OperationId, len(op.Parameters))
+				continue
+			}
+			// the deprecated tag is parsed like in the schema of the parameter
+			author := op.Parameters[1]
+			if !author.Deprecated || !*author.Schema.Schema().Deprecated {
+				t.Errorf("%s: %s is not deprecated", op.OperationId, author.Name)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type address struct {
+		City string `json:"city" validate:"required"`
+	}
+	type input struct {
+		Name    string   `json:"name"           validate:"required,min=2,max=8"`
+		Email   string   `json:"email,omitempty" validate:"format=email"`
+		Role    string   `json:"role,omitempty"  validate:"enum=admin|user"`
+		Code    string   `json:"code,omitempty"  validate:"pattern=^[A-Z]{2,3}$"`
+		Count   int      `json:"count"          validate:"min=1"`
+		Address *address `json:"address"`
+		Page    *int     `query:"page" validate:"min=1"`
+	}
+
+	r := router.New()
+	router.Post(r, "/users", func(ctx *router.Context[input]) (input, error) {
+		return ctx.GetBody()
+	})
+
+	body := `{"name":"a","email":"nope","role":"root","code":"abcd","address":{}}`
+	req := httptest.NewRequest(http.MethodPost, "/users?page=0", strings.NewReader(body))
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", res.Code, http.StatusUnprocessableEntity)
+	}
+
+	var httpErr router.HTTPError
+	if err := json.NewDecoder(res.Body).Decode(&httpErr); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range httpErr.Errors {
+		got = append(got, item.Name+":"+item.Metadata["rule"].(string))
+	}
+	want := []string{"name:min", "email:format", "role:enum", "code:pattern", "count:min", "address.city:required", "page:min"}
+	if !slices.Equal(got, want) {
+		t.Errorf("errors = %v, want %v", got, want)
+	}
+
+	schema, _ := r.Schema().Components.Schemas.Get("go.grass.garden/router_test.input")
+	name, _ := schema.Schema().Properties.Get("name")
+	if s := name.Schema(); *s.MinLength != 2 || *s.MaxLength != 8 {
+		t.Errorf("name schema length = [%d, %d], want [2, 8]", *s.MinLength, *s.MaxLength)
+	}
+	if required := schema.Schema().Required; !slices.Equal(required, []string{"name", "count"}) {
+		t.Errorf("required = %v, want [name count]", required)
+	}
+
+	// rules other than required do not apply to the zero value of optional
+	// fields, but do to that of fields the schema marks as required
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{`{"name":"ada","count":1}`, http.StatusCreated},
+		{`{"name":"ada"}`, http.StatusUnprocessableEntity},
+	} {
+		res = httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tc.body)))
+		if res.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d: %s", tc.body, res.Code, tc.status, res.Body)
+		}
+	}
+
+	// invalid rules are reported when the route is registered
+	type invalid struct {
+		Name string `json:"name" validate:"pattern=("`
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a route with an invalid pattern rule did not panic")
+		}
+	}()
+	router.Post(router.New(), "/invalid", func(ctx *router.Context[invalid]) (invalid, error) {
+		return ctx.GetBody()
+	})
+}
+
+func TestConsumes(t *testing.T) {
+	type input struct {
+		Name string `json:"name"`
+	}
+
+	r := router.New()
+	router.Post(r, "/users", func(ctx *router.Context[input]) (input, error) {
+		return ctx.GetBody()
+	})
+
+	for _, tc := range []struct {
+		contentType string
+		status      int
+	}{
+		{"application/json; charset=utf-8", http.StatusCreated},
+		{"", http.StatusCreated},
+		{"text/plain", http.StatusUnsupportedMediaType},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"grass"}`))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != tc.status {
+			t.Errorf("%q: status = %d, want %d", tc.contentType, res.Code, tc.status)
+		}
+	}
+}
+
+func TestMalformedBody(t *testing.T) {
+	type input struct {
+		Name string `json:"name" xml:"name"`
+	}
+
+	for _, tc := range []struct {
+		serializer router.Serializer
+		body       string
+	}{
+		{router.XMLSerializer{}, "<input><name>grass"},
+		{router.YAMLSerializer{}, "name: [grass"},
+		{router.MessagePackSerializer{}, "\xc1"},
+		{router.CBORSerializer{}, "\xa1\x64name"},
+	} {
+		contentType := tc.serializer.ContentType()
+		r := router.New(router.WithSerializers(tc.serializer), router.WithContentType(contentType))
+		router.Post(r, "/users", func(ctx *router.Context[input]) (input, error) {
+			return ctx.GetBody()
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", "application/json")
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", contentType, res.Code, http.StatusBadRequest)
+		}
+		if !strings.Contains(res.Body.String(), "The request body is malformed") {
+			t.Errorf("%s: body = %s", contentType, res.Body.String())
+		}
+	}
+}
+
+type textSerializer struct{}
+
+func (textSerializer) Marshal(w io.Writer, v any) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+func (textSerializer) Unmarshal(data []byte, v any) error {
+	*(v.(*string)) = string(data)
+	return nil
+}
+
+func (textSerializer) ContentType() string {
+	return "text/plain"
+}
+
+func TestNegotiate(t *testing.T) {
+	r := router.New(router.WithSerializers(textSerializer{}))
+	router.Get(r, "/hello", func(*router.ContextAny) (string, error) {
+		return "hello", nil
+	})
+
+	for _, tc := range []struct {
+		accept string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, "\"hello\"\n"},
+		{"*/*", http.StatusOK, "\"hello\"\n"},
+		{"text/*", http.StatusOK, "hello"},
+		{"application/json;q=0.5, text/plain", http.StatusOK, "hello"},
+		{"*/*;q=0.1, application/json;q=0", http.StatusOK, "hello"},
+		{"image/png", http.StatusNotAcceptable, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		req.Header.Set("Accept", tc.accept)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != tc.status {
+			t.Errorf("%q: status = %d, want %d", tc.accept, res.Code, tc.status)
+		}
+		if tc.body != "" && res.Body.String() != tc.body {
+			t.Errorf("%q: body = %q, want %q", tc.accept, res.Body.String(), tc.body)
+		}
+	}
+
+	op := r.Schema().Paths.PathItems.Value("/hello").Get
+	content := op.Responses.Codes.Value("200").Content
+	if _, ok := content.Get("text/plain"); !ok || content.Len() != 2 {
+		t.Errorf("response content types = %d, want application/json and text/plain", content.Len())
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := router.New().OpenAPI("/docs")
+	router.Get(r, "/hello", func(*router.ContextAny) (string, error) {
+		return "hello", nil
+	})
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/docs/openapi.json", nil))
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Paths["/hello"]; !ok || len(doc.Paths) != 1 {
+		t.Errorf("paths = %v, want only /hello", slices.Collect(maps.Keys(doc.Paths)))
+	}
+
+	etag := res.Header().Get("ETag")
+	for _, tc := range []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/docs/openapi.json", nil)
+		req.Header.Set("If-None-Match", tc.ifNoneMatch)
+		res = httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != tc.status {
+			t.Errorf("If-None-Match %s: status = %d, want %d", tc.ifNoneMatch, res.Code, tc.status)
+		}
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/docs/openapi.yaml", nil))
+	if !strings.HasPrefix(res.Body.String(), "openapi: 3.1.0") {
+		t.Errorf("yaml body = %q", res.Body.String())
+	}
+}
+
+func TestDocs(t *testing.T) {
+	r := router.New()
+	r.Group("/api").Docs("/docs")
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/api/docs", http.StatusMovedPermanently},
+		{"/api/docs/", http.StatusOK},
+		{"/api/docs/assets/docs.js", http.StatusOK},
+		{"/api/docs/assets/docs.css", http.StatusOK},
+		{"/api/docs/openapi.json", http.StatusOK},
+	} {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if res.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.path, res.Code, tc.status)
+		}
+		if strings.Contains(res.Body.String(), "://") && !strings.HasSuffix(tc.path, ".json") {
+			t.Errorf("%s: references an external URL", tc.path)
+		}
+	}
+}
+
+func TestOperationMetadata(t *testing.T) {
+	r := router.New()
+	router.Delete(r, "/users/{id}", func(*router.ContextAny) (any, error) {
+		return nil, nil
+	}).
+		OperationID("deleteUser").
+		Summary("Delete a user").
+		Tags("users").
+		Deprecated().
+		Status(http.StatusNoContent).
+		Response(http.StatusNotFound, "User not found", router.HTTPError{}).
+		Extension("rate-limit", 10)
+
+	op := r.Schema().Paths.PathItems.Value("/users/{id}").Delete
+	if op.OperationId != "deleteUser" || op.Summary != "Delete a user" || !slices.Equal(op.Tags, []string{"users"}) {
+		t.Errorf("operation = %s %q %v", op.OperationId, op.Summary, op.Tags)
+	}
+	if op.Deprecated == nil || !*op.Deprecated {
+		t.Error("operation is not deprecated")
+	}
+	for _, code := range []string{"204", "404"} {
+		if _, ok := op.Responses.Codes.Get(code); !ok {
+			t.Errorf("missing response %s", code)
+		}
+	}
+	if v, ok := op.Extensions.Get("x-rate-limit"); !ok || v.Value != "10" {
+		t.Errorf("x-rate-limit = %v", v)
+	}
+}
+
+func TestDeclaredErrors(t *testing.T) {
+	r := router.New()
+	router.Get(r, "/users/{id}", func(*router.ContextAny) (any, error) {
+		return nil, nil
+	}).Errors(
+		router.NotFoundError{Detail: "User not found"},
+		router.ConflictError{Detail: "User is locked"},
+		router.ConflictError{Detail: "User is archived"},
+	)
+
+	codes := r.Schema().Paths.PathItems.Value("/users/{id}").Get.Responses.Codes
+	if got := slices.Collect(codes.KeysFromOldest()); !slices.Equal(got, []string{"200", "404", "409"}) {
+		t.Errorf("responses = %v, want [200 404 409]", got)
+	}
+
+	examples := codes.Value("409").Content.Value("application/problem+json").Examples
+	if examples.Len() != 2 {
+		t.Errorf("409 examples = %d, want 2", examples.Len())
+	}
+	example := codes.Value("404").Content.Value("application/problem+json").Examples.Value("NotFoundError")
+	var got router.HTTPError
+	if err := example.Value.Decode(&got); err != nil || got.Detail != "User not found" {
+		t.Errorf("404 example = %+v, %v", got, err)
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	r := router.New()
+	router.Get(r, "/accounts/{id}", func(*router.ContextAny) (any, error) {
+		return nil, router.HTTPError{
+			Type:       "https://example.com/probs/out-of-credit",
+			Status:     http.StatusForbidden,
+			Detail:     "Your current balance is 30, but that costs 50.",
+			Extensions: map[string]any{"balance": 30},
+		}
+	})
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/accounts/12", nil))
+
+	var got map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"type":     "https://example.com/probs/out-of-credit",
+		"title":    "Forbidden",
+		"status":   float64(http.StatusForbidden),
+		"detail":   "Your current balance is 30, but that costs 50.",
+		"instance": "/accounts/12",
+		"balance":  float64(30),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problem = %v, want %v", got, want)
+	}
+
+	// XML clients get problem details as XML
+	r = router.New(router.WithSerializers(router.XMLSerializer{}))
+	router.Get(r, "/accounts/{id}", func(*router.ContextAny) (any, error) {
+		return nil, router.ForbiddenError{Detail: "No credit"}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/12", nil)
+	req.Header.Set("Accept", "application/xml")
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if ct := res.Header().Get("Content-Type"); ct != "application/problem+xml" {
+		t.Errorf("content type = %q, want application/problem+xml", ct)
+	}
+	if !strings.Contains(res.Body.String(), "<detail>No credit</detail>") {
+		t.Errorf("body = %q, want an XML problem", res.Body.String())
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	type input struct {
+		Count int `json:"count"`
+	}
+
+	r := router.New()
+	router.Post(r, "/items", func(ctx *router.Context[input]) (input, error) {
+		return ctx.GetBody()
+	})
+	router.Get(r, "/slow", func(*router.ContextAny) (any, error) {
+		return nil, fmt.Errorf("query: %w", context.DeadlineExceeded)
+	})
+	router.Get(r, "/maintenance", func(*router.ContextAny) (any, error) {
+		return nil, router.ServiceUnavailableError{
+			Err:        errors.New("maintenance"),
+			RetryAfter: 90 * time.Second,
+		}
+	})
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/items", `{"count":`, http.StatusBadRequest},
+		{http.MethodPost, "/items", `{"count":"ten"}`, http.StatusUnprocessableEntity},
+		{http.MethodGet, "/slow", "", http.StatusGatewayTimeout},
+		{http.MethodGet, "/maintenance", "", http.StatusServiceUnavailable},
+	} {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if res.Code != tc.status {
+			t.Errorf("%s %s: status = %d, want %d", tc.method, tc.path, res.Code, tc.status)
+		}
+		if tc.status == http.StatusServiceUnavailable && res.Header().Get("Retry-After") != "90" {
+			t.Errorf("Retry-After = %q, want 90", res.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestErrorProcessors(t *testing.T) {
+	var order []string
+	trace := func(name string) router.ErrorProcessor {
+		return func(err error) error {
+			order = append(order, name)
+			return err
+		}
+	}
+
+	r := router.New(router.WithErrorProcessors(trace("router"), router.RedactInternalErrors()))
+	api := r.Group("/api", router.WithErrorProcessors(trace("group")))
+	router.Get(api, "/fail", func(*router.ContextAny) (any, error) {
+		return nil, router.BadGatewayError{
+			Err:    errors.New("dial tcp 10.0.0.1:5432: connection refused"),
+			Detail: "database at 10.0.0.1 is unreachable",
+		}
+	}).ErrorProcessors(trace("route"))
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/fail", nil))
+	if res.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", res.Code, http.StatusBadGateway)
+	}
+	if strings.Contains(res.Body.String(), "10.0.0.1") {
+		t.Errorf("body leaks internal details: %s", res.Body.String())
+	}
+	if !slices.Equal(order, []string{"router", "group", "route"}) {
+		t.Errorf("processors ran in order %v", order)
+	}
+
+	// stacks of panics are only added in debug mode, to server errors
+	for _, debug := range []bool{true, false} {
+		r := router.New(router.WithDebug(debug), router.WithErrorProcessors(router.StackTraces()))
+		router.Get(r, "/panic", func(*router.ContextAny) (any, error) {
+			panic("boom")
+		})
+		router.Get(r, "/missing", func(*router.ContextAny) (any, error) {
+			panic(router.NotFoundError{Err: errors.New("no such item")})
+		})
+
+		for _, path := range []string{"/panic", "/missing"} {
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+
+			var problem struct {
+				Stack []string `json:"stack"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			wantStack := debug && path == "/panic"
+			if got := slices.ContainsFunc(problem.Stack, func(line string) bool {
+				return strings.Contains(line, "TestErrorProcessors")
+			}); got != wantStack {
+				t.Errorf("debug %v, %s: stack from the panicking handler = %v, want %v", debug, path, got, wantStack)
+			}
+		}
+	}
+}
+
+func TestMiddlewareAround(t *testing.T) {
+	var events []string
+	r := router.New().Use(func(ctx *router.ContextAny) error {
+		events = append(events, "before")
+		err := ctx.Next()
+		events = append(events, fmt.Sprintf("after %v %d", ctx.Output(), ctx.Status()))
+		return err
+	})
+	router.Get(r, "/ok", func(*router.ContextAny) (string, error) {
+		events = append(events, "handler")
+		return "ok", nil
+	}).Use(func(ctx *router.ContextAny) error {
+		if err := ctx.Next(); err != nil {
+			return err
+		}
+		ctx.SetOutput(strings.ToUpper(ctx.Output().(string)))
+		return nil
+	})
+	router.Get(r, "/missing", func(*router.ContextAny) (string, error) {
+		return "", router.NotFoundError{Err: errors.New("missing")}
+	}).Use(func(ctx *router.ContextAny) error {
+		if err := ctx.Next(); errors.As(err, &router.NotFoundError{}) {
+			ctx.SetStatus(http.StatusOK)
+			ctx.SetOutput("fallback")
+		}
+		return nil
+	})
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if res.Body.String() != "\"OK\"\n" {
+		t.Errorf("body = %q, want %q", res.Body.String(), "\"OK\"\n")
+	}
+	if want := []string{"before", "handler", "after OK 200"}; !slices.Equal(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if res.Code != http.StatusOK || res.Body.String() != "\"fallback\"\n" {
+		t.Errorf("response = %d %q, want 200 fallback", res.Code, res.Body.String())
+	}
+
+	// middlewares not calling Next stop the request
+	r = router.New()
+	router.Get(r, "/denied", func(*router.ContextAny) (string, error) {
+		t.Error("handler ran after a middleware stopped the request")
+		return "", nil
+	}).Use(func(ctx *router.ContextAny) error {
+		ctx.SetStatus(http.StatusNoContent)
+		return nil
+	})
+	router.Get(r, "/cached", func(*router.ContextAny) (string, error) {
+		t.Error("handler ran after a middleware stopped the request")
+		return "", nil
+	}).Use(func(ctx *router.ContextAny) error {
+		ctx.SetOutput("cached")
+		return nil
+	})
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/denied", nil))
+	if res.Code != http.StatusNoContent || res.Body.Len() != 0 {
+		t.Errorf("response = %d %q, want 204 without body", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/cached", nil))
+	if res.Code != http.StatusOK || res.Body.String() != "\"cached\"\n" {
+		t.Errorf("response = %d %q, want 200 cached", res.Code, res.Body.String())
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	r := router.New().Use(func(ctx *router.ContextAny) error {
+		start := time.Now()
+		err := ctx.Next()
+		ctx.SetHeader("Server-Timing", fmt.Sprintf("app;dur=%d", time.Since(start).Milliseconds()))
+		return err
+	})
+	router.Get(r, "/json", func(*router.ContextAny) (string, error) {
+		return "ok", nil
+	})
+	router.Get(r, "/stream", func(ctx *router.ContextAny) (any, error) {
+		ctx.SetHeader("Content-Type", "text/plain")
+		ctx.SetStatus(http.StatusAccepted)
+		_, _ = io.WriteString(ctx.ResponseWriter(), "chunk")
+		if err := http.NewResponseController(ctx.ResponseWriter()).Flush(); err != nil {
+			return nil, err
+		}
+		if !ctx.Committed() || ctx.BytesWritten() != 5 {
+			t.Errorf("committed = %v, written = %d", ctx.Committed(), ctx.BytesWritten())
+		}
+		return nil, nil
+	})
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/json", nil))
+	if got := res.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if res.Header().Get("Server-Timing") == "" {
+		t.Error("header set after the handler was not sent")
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if res.Code != http.StatusAccepted || res.Body.String() != "chunk" || !res.Flushed {
+		t.Errorf("response = %d %q flushed=%v, want 202 chunk flushed", res.Code, res.Body.String(), res.Flushed)
+	}
+	if res.Result().Header.Get("Server-Timing") != "" {
+		t.Error("header set after the response was committed was sent")
+	}
+
+	// encoding errors happen before the response is committed
+	r = router.New()
+	router.Get(r, "/invalid", func(*router.ContextAny) (any, error) {
+		return make(chan int), nil
+	})
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/invalid", nil))
+	if res.Code != http.StatusInternalServerError || res.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("response = %d %s, want a 500 problem", res.Code, res.Header().Get("Content-Type"))
+	}
+}
+
+func TestSSE(t *testing.T) {
+	type tick struct {
+		N int `json:"n"`
+	}
+
+	r := router.New()
+	router.SSE(r, "/ticks", func(ctx *router.ContextAny, events *router.EventSender[tick]) error {
+		if ctx.QueryParam("fail") != "" {
+			return router.BadRequestError{Err: errors.New("fail")}
+		}
+		start, _ := strconv.Atoi(events.LastEventID())
+		for n := start + 1; n <= start+2; n++ {
+			if err := events.SendEvent(router.Event[tick]{ID: strconv.Itoa(n), Name: "tick", Data: tick{n}}); err != nil {
+				return err
+			}
+		}
+		return events.Retry(time.Second)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ticks", nil)
+	req.Header.Set("Last-Event-ID", "4")
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	want := "id: 5\nevent: tick\ndata: {\"n\":5}\n\n" +
+		"id: 6\nevent: tick\ndata: {\"n\":6}\n\n" +
+		"retry: 1000\n\n"
+	if res.Body.String() != want {
+		t.Errorf("body = %q, want %q", res.Body.String(), want)
+	}
+	if got := res.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ticks?fail=1", nil))
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", res.Code, http.StatusBadRequest)
+	}
+
+	op := r.Schema().Paths.PathItems.Value("/ticks").Get
+	if _, ok := op.Responses.Codes.Value("200").Content.Get("text/event-stream"); !ok {
+		t.Error("missing text/event-stream response content")
+	}
+}
+
+// wsClient is a minimal RFC 6455 client sending masked frames.
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, addr, path string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr)
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusSwitchingProtocols)
+	}
+	if got := res.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	return &wsClient{conn: conn, br: br}
+}
+
+func (c *wsClient) write(opcode byte, payload string) {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i := range len(payload) {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	_, _ = c.conn.Write(frame)
+}
+
+func (c *wsClient) read() (byte, string, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return 0, "", err
+	}
+	payload := make([]byte, header[1]&0x7f)
+	_, err := io.ReadFull(c.br, payload)
+	return header[0] & 0x0f, string(payload), err
+}
+
+func TestWebSocket(t *testing.T) {
+	type message struct {
+		Text string `json:"text"`
+	}
+
+	r := router.New()
+	router.WebSocket(r, "/echo", func(ctx *router.ContextAny, conn *router.WebSocketConn[message, message]) error {
+		for {
+			msg, err := conn.Read()
+			var closeErr *router.CloseError
+			if errors.As(err, &closeErr) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if msg.Text == "bye" {
+				return &router.CloseError{Code: router.ClosePolicyViolation, Reason: "bye"}
+			}
+			if err := conn.Write(message{Text: strings.ToUpper(msg.Text)}); err != nil {
+				return err
+			}
+		}
+	})
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusUpgradeRequired)
+	}
+
+	client := dialWebSocket(t, srv.Listener.Addr().String(), "/echo")
+	client.write(0x1, `{"text":"hello"}`)
+	if op, payload, err := client.read(); err != nil || op != 0x1 || payload != `{"text":"HELLO"}` {
+		t.Errorf("read = %x %q %v, want text message", op, payload, err)
+	}
+
+	client.write(0x9, "ping")
+	if op, payload, err := client.read(); err != nil || op != 0xa || payload != "ping" {
+		t.Errorf("read = %x %q %v, want pong", op, payload, err)
+	}
+
+	client.write(0x1, `{"text":"bye"}`)
+	op, payload, err := client.read()
+	if err != nil || op != 0x8 {
+		t.Fatalf("read = %x %q %v, want close", op, payload, err)
+	}
+	if code := binary.BigEndian.Uint16([]byte(payload)); code != router.ClosePolicyViolation || payload[2:] != "bye" {
+		t.Errorf("close = %d %q, want %d bye", code, payload[2:], router.ClosePolicyViolation)
+	}
+	client.write(0x8, payload[:2])
+
+	client = dialWebSocket(t, srv.Listener.Addr().String(), "/echo")
+	client.write(0x8, "\x03\xe8")
+	if op, payload, err := client.read(); err != nil || op != 0x8 || payload != "\x03\xe8" {
+		t.Errorf("read = %x %q %v, want close echo", op, payload, err)
+	}
+
+	// handler errors go through the error processors
+	processed := make(chan error, 1)
+	r = router.New(router.WithErrorProcessors(func(err error) error {
+		processed <- err
+		return err
+	}))
+	router.WebSocket(r, "/fail", func(ctx *router.ContextAny, conn *router.WebSocketConn[message, message]) error {
+		return errors.New("boom")
+	})
+	srv2 := httptest.NewServer(r)
+	defer srv2.Close()
+
+	client = dialWebSocket(t, srv2.Listener.Addr().String(), "/fail")
+	if op, payload, err := client.read(); err != nil || op != 0x8 || binary.BigEndian.Uint16([]byte(payload)) != router.CloseInternalError {
+		t.Errorf("read = %x %q %v, want close with an internal error", op, payload, err)
+	}
+	select {
+	case err := <-processed:
+		if httpErr := (router.HTTPError{}); !errors.As(err, &httpErr) || httpErr.Err.Error() != "boom" {
+			t.Errorf("processed error = %v, want boom", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("handler error was not processed")
+	}
+
+	// cross-origin handshakes are rejected unless allowed
+	handshake := func(url, origin string) int {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Origin", origin)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := handshake(srv.URL+"/echo", "https://evil.example"); code != http.StatusForbidden {
+		t.Errorf("cross-origin status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := handshake(srv.URL+"/echo", srv.URL); code != http.StatusSwitchingProtocols {
+		t.Errorf("same-origin status = %d, want %d", code, http.StatusSwitchingProtocols)
+	}
+
+	r = router.New(router.WithWebSocketOrigin(func(req *http.Request) bool {
+		return req.Header.Get("Origin") == "https://app.example"
+	}))
+	router.WebSocket(r, "/echo", func(ctx *router.ContextAny, conn *router.WebSocketConn[message, message]) error {
+		return nil
+	})
+	srv3 := httptest.NewServer(r)
+	defer srv3.Close()
+	if code := handshake(srv3.URL+"/echo", "https://app.example"); code != http.StatusSwitchingProtocols {
+		t.Errorf("allowed origin status = %d, want %d", code, http.StatusSwitchingProtocols)
+	}
+}
+
+func TestStream(t *testing.T) {
+	type row struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	r := router.New()
+	router.Get(r, "/rows", func(ctx *router.ContextAny) (iter.Seq2[row, error], error) {
+		return func(yield func(row, error) bool) {
+			if ctx.QueryParam("fail") != "" {
+				yield(row{}, router.ServiceUnavailableError{Err: errors.New("unavailable")})
+				return
+			}
+			for i := 1; i <= 2; i++ {
+				if !yield(row{ID: i, Name: "row, " + strconv.Itoa(i)}, nil) {
+					return
+				}
+			}
+		}, nil
+	})
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "application/x-ndjson", "{\"id\":1,\"name\":\"row, 1\"}\n{\"id\":2,\"name\":\"row, 2\"}\n"},
+		{"application/json", "application/json", "[{\"id\":1,\"name\":\"row, 1\"},{\"id\":2,\"name\":\"row, 2\"}]\n"},
+		{"text/csv", "text/csv", "id,name\n1,\"row, 1\"\n2,\"row, 2\"\n"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/rows", nil)
+		req.Header.Set("Accept", test.accept)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+
+		if got := res.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", test.accept, got, test.contentType)
+		}
+		if res.Body.String() != test.body {
+			t.Errorf("Accept %q: body = %q, want %q", test.accept, res.Body.String(), test.body)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/rows?fail=1", nil))
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", res.Code, http.StatusServiceUnavailable)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/rows", nil).WithContext(ctx))
+	if res.Code != router.StatusClientClosedRequest {
+		t.Errorf("status = %d, want %d", res.Code, router.StatusClientClosedRequest)
+	}
+
+	op := r.Schema().Paths.PathItems.Value("/rows").Get
+	content := op.Responses.Codes.Value("200").Content
+	if s := content.Value("application/json").Schema.Schema(); s.Type[0] != "array" {
+		t.Errorf("application/json schema type = %v, want array", s.Type)
+	}
+	if ref := content.Value("application/x-ndjson").Schema.GetReference(); !strings.HasSuffix(ref, ".row") {
+		t.Errorf("application/x-ndjson schema = %q, want row reference", ref)
+	}
+}
+
+func TestForm(t *testing.T) {
+	type upload struct {
+		Title string                `form:"title" validate:"required"`
+		Tags  []string              `form:"tag"`
+		File  *multipart.FileHeader `form:"file"`
+	}
+	type signup struct {
+		Name string `json:"name" form:"full_name"`
+		Age  int    `form:"age"`
+	}
+
+	r := router.New(router.WithFormLimits(1<<10, 1<<10))
+	router.Post(r, "/uploads", func(ctx *router.Context[upload]) (string, error) {
+		body, err := ctx.GetBody()
+		if err != nil {
+			return "", err
+		}
+		f, err := body.File.Open()
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		return fmt.Sprintf("%s %v %s %s", body.Title, body.Tags, body.File.Filename, data), nil
+	})
+	router.Post(r, "/signups", func(ctx *router.Context[signup]) (signup, error) {
+		return ctx.GetBody()
+	})
+	router.Post(r, "/stream", func(ctx *router.ContextAny) (int64, error) {
+		var total int64
+		for part, err := range ctx.Parts() {
+			if err != nil {
+				return 0, err
+			}
+			n, err := io.Copy(io.Discard, part)
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+		return total, nil
+	})
+
+	multipartBody := func(fileSize int) (*strings.Builder, string) {
+		body := &strings.Builder{}
+		w := multipart.NewWriter(body)
+		_ = w.WriteField("title", "report")
+		_ = w.WriteField("tag", "a")
+		_ = w.WriteField("tag", "b")
+		fw, _ := w.CreateFormFile("file", "report.txt")
+		_, _ = io.WriteString(fw, strings.Repeat("x", fileSize))
+		_ = w.Close()
+		return body, w.FormDataContentType()
+	}
+
+	body, contentType := multipartBody(3)
+	req := httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", contentType)
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if want := "\"report [a b] report.txt xxx\"\n"; res.Body.String() != want {
+		t.Errorf("body = %q, want %q", res.Body.String(), want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/signups", strings.NewReader("full_name=ada&age=36"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if want := "{\"name\":\"ada\",\"Age\":36}\n"; res.Body.String() != want {
+		t.Errorf("body = %q, want %q", res.Body.String(), want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/signups", strings.NewReader("age=old"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", res.Code, http.StatusBadRequest)
+	}
+
+	body, contentType = multipartBody(1200)
+	req = httptest.NewRequest(http.MethodPost, "/stream", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", contentType)
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Body.String() != "1208\n" {
+		t.Errorf("body = %q, want 1208", res.Body.String())
+	}
+
+	body, contentType = multipartBody(4 << 10)
+	for _, path := range []string{"/uploads", "/stream"} {
+		req = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", contentType)
+		res = httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status = %d, want %d", path, res.Code, http.StatusRequestEntityTooLarge)
+		}
+	}
+
+	doc := r.Schema()
+	op := doc.Paths.PathItems.Value("/uploads").Post
+	if _, ok := op.RequestBody.Content.Get("multipart/form-data"); !ok || op.RequestBody.Content.Len() != 1 {
+		t.Errorf("request content = %v, want only multipart/form-data", slices.Collect(op.RequestBody.Content.KeysFromOldest()))
+	}
+	schema := op.RequestBody.Content.Value("multipart/form-data").Schema.Schema()
+	file := schema.Properties.Value("file").Schema()
+	if file.Type[0] != "string" || file.Format != "binary" {
+		t.Errorf("file schema = %v %q, want string binary", file.Type, file.Format)
+	}
+
+	// form schemas are named after the form tags bindForm reads
+	op = doc.Paths.PathItems.Value("/signups").Post
+	schema = op.RequestBody.Content.Value("application/x-www-form-urlencoded").Schema.Schema()
+	if got := slices.Collect(schema.Properties.KeysFromOldest()); !slices.Equal(got, []string{"full_name", "age"}) {
+		t.Errorf("form properties = %v, want [full_name age]", got)
+	}
+}
+
+func TestSerializers(t *testing.T) {
+	type nested struct {
+		Name string `json:"name" xml:"name"`
+	}
+	type value struct {
+		Bool    bool              `json:"bool" xml:"bool"`
+		String  string            `json:"string" xml:"string"`
+		Int     int               `json:"int" xml:"int"`
+		Int8    int8              `json:"int8" xml:"int8"`
+		Int64   int64             `json:"int64" xml:"int64"`
+		Uint16  uint16            `json:"uint16" xml:"uint16"`
+		Uint64  uint64            `json:"uint64" xml:"uint64"`
+		Float32 float32           `json:"float32" xml:"float32"`
+		Float64 float64           `json:"float64" xml:"float64"`
+		Array   [2]string         `json:"array" xml:"-"`
+		Slice   []int             `json:"slice" xml:"slice"`
+		Pointer *nested           `json:"pointer" xml:"pointer"`
+		Nested  nested            `json:"nested" xml:"nested"`
+		Map     map[string]int    `json:"map" xml:"-"`
+		Any     any               `json:"any" xml:"-"`
+		Time    time.Time         `json:"time" xml:"time"`
+		Empty   *nested           `json:"empty" xml:"empty"`
+		Labels  map[string]string `json:"labels,omitempty" xml:"-"`
+	}
+	type flat struct {
+		Name   string   `json:"name"`
+		Age    int      `json:"age"`
+		Active bool     `json:"active"`
+		Score  float64  `json:"score"`
+		Tags   []string `json:"tags"`
+	}
+
+	full := value{
+		Bool: true, String: strings.Repeat("é", 40), Int: -70000, Int8: -5, Int64: math.MinInt64,
+		Uint16: 300, Uint64: math.MaxUint64, Float32: 1.5, Float64: -2.25,
+		Array: [2]string{"a", "b"}, Slice: []int{1, -1, 1 << 40}, Pointer: &nested{"p"},
+		Nested: nested{"n"}, Map: map[string]int{"a": 1, "b": 2}, Any: []any{"x", 1.0, true, nil},
+		Time: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+	}
+	xmlValue := full
+	xmlValue.Map, xmlValue.Any, xmlValue.Array = nil, nil, [2]string{}
+
+	tests := []struct {
+		serializer  router.Serializer
+		contentType string
+		in, out     any
+	}{
+		{router.JSONSerializer{}, "application/json", &full, &value{}},
+		{router.XMLSerializer{}, "application/xml", &xmlValue, &value{}},
+		{router.YAMLSerializer{}, "application/yaml", &full, &value{}},
+		{router.MessagePackSerializer{}, "application/msgpack", &full, &value{}},
+		{router.CBORSerializer{}, "application/cbor", &full, &value{}},
+		{router.FormSerializer{}, "application/x-www-form-urlencoded", &flat{"ada", 36, true, 1.5, []string{"a", "b"}}, &flat{}},
+	}
+	for _, test := range tests {
+		if got := test.serializer.ContentType(); got != test.contentType {
+			t.Errorf("%T: ContentType() = %q, want %q", test.serializer, got, test.contentType)
+		}
+
+		var buf strings.Builder
+		if err := test.serializer.Marshal(&buf, test.in); err != nil {
+			t.Errorf("%T: Marshal: %v", test.serializer, err)
+			continue
+		}
+		if err := test.serializer.Unmarshal([]byte(buf.String()), test.out); err != nil {
+			t.Errorf("%T: Unmarshal: %v", test.serializer, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.in, test.out) {
+			t.Errorf("%T: round trip = %+v, want %+v", test.serializer, test.out, test.in)
+		}
+	}
+
+	// MessagePack and CBOR encodings from their specifications
+	var m map[string]any
+	if err := (router.MessagePackSerializer{}).Unmarshal([]byte("\x82\xa7compact\xc3\xa6schema\x00"), &m); err != nil ||
+		!reflect.DeepEqual(m, map[string]any{"compact": true, "schema": 0.0}) {
+		t.Errorf("msgpack = %v, %v", m, err)
+	}
+	var a []any
+	if err := (router.CBORSerializer{}).Unmarshal([]byte("\x9f\x01\x82\x02\x03\xf9\x3c\x00\x63abc\xff"), &a); err != nil ||
+		!reflect.DeepEqual(a, []any{1.0, []any{2.0, 3.0}, 1.0, "abc"}) {
+		t.Errorf("cbor = %v, %v", a, err)
+	}
+	var buf strings.Builder
+	_ = router.CBORSerializer{}.Marshal(&buf, map[string]any{"a": 1, "b": []int{2, 3}})
+	if want := "\xa2\x61a\x01\x61b\x82\x02\x03"; buf.String() != want {
+		t.Errorf("cbor = %x, want %x", buf.String(), want)
+	}
+	if err := (router.CBORSerializer{}).Unmarshal([]byte("\x9b\xff\xff\xff\xff\xff\xff\xff\xff"), &a); err == nil {
+		t.Error("cbor: expected an error for a truncated array")
+	}
+
+	// values that cannot be encoded leave the writer untouched
+	for _, serializer := range []router.Serializer{
+		router.JSONSerializer{}, router.XMLSerializer{}, router.YAMLSerializer{},
+		router.MessagePackSerializer{}, router.CBORSerializer{}, router.FormSerializer{},
+	} {
+		var buf strings.Builder
+		err := serializer.Marshal(&buf, map[string]any{"ch": make(chan int)})
+		if err == nil || buf.Len() != 0 {
+			t.Errorf("%T: Marshal = %q, %v, want an error and no output", serializer, buf.String(), err)
+		}
+	}
+	r := router.New(router.WithSerializers(router.XMLSerializer{}))
+	router.Get(r, "/map", func(*router.ContextAny) (map[string]string, error) {
+		return map[string]string{"a": "b"}, nil
+	})
+	req := httptest.NewRequest(http.MethodGet, "/map", nil)
+	req.Header.Set("Accept", "application/xml")
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusInternalServerError || res.Header().Get("Content-Type") != "application/problem+xml" {
+		t.Errorf("response = %d %q, want a 500 problem", res.Code, res.Body.String())
+	}
+
+	// the form serializer binds like forms without it
+	type signup struct {
+		Name string `json:"name" form:"full_name"`
+		Age  int    `form:"age"`
+	}
+	r = router.New(router.WithSerializers(router.FormSerializer{}))
+	router.Post(r, "/signups", func(ctx *router.Context[signup]) (signup, error) {
+		return ctx.GetBody()
+	})
+	for _, tc := range []struct {
+		body string
+		code int
+		want string
+	}{
+		{"full_name=ada&age=36", http.StatusCreated, "{\"name\":\"ada\",\"Age\":36}\n"},
+		{"age=old", http.StatusBadRequest, "age"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/signups", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != tc.code {
+			t.Errorf("%s: status = %d, want %d", tc.body, res.Code, tc.code)
+		}
+		if tc.code != http.StatusBadRequest {
+			if res.Body.String() != tc.want {
+				t.Errorf("%s: body = %q, want %q", tc.body, res.Body.String(), tc.want)
+			}
+			continue
+		}
+		var httpErr router.HTTPError
+		if err := json.NewDecoder(res.Body).Decode(&httpErr); err != nil {
+			t.Fatal(err)
+		}
+		if len(httpErr.Errors) != 1 || httpErr.Errors[0].Name != tc.want {
+			t.Errorf("%s: errors = %+v, want an item for %s", tc.body, httpErr.Errors, tc.want)
+		}
+	}
+}
+
+type treeNode struct {
+	Value    string     `json:"value"`
+	Children []treeNode `json:"children"`
+}
+
+type listNode struct {
+	Value int       `json:"value"`
+	Next  *listNode `json:"next"`
+}
+
+type graphNode struct {
+	ID    string      `json:"id"`
+	Edges []graphEdge `json:"edges"`
+}
+
+type graphEdge struct {
+	Weight int        `json:"weight"`
+	To     *graphNode `json:"to"`
+}
+
+func FuzzMessagePack(f *testing.F) {
+	fuzzSerializer(f, router.MessagePackSerializer{})
+}
+
+func FuzzCBOR(f *testing.F) {
+	f.Add([]byte("\x9f\x01\x82\x02\x03\xf9\x3c\x00\x63abc\xff"))
+	f.Add([]byte("\xbf\x61a\x5f\x41b\xff\xff"))
+	fuzzSerializer(f, router.CBORSerializer{})
+}
+
+// fuzzSerializer checks that s does not panic on arbitrary input, and that
+// the values it decodes encode back to themselves.
+func fuzzSerializer(f *testing.F, s router.Serializer) {
+	for _, v := range []any{
+		nil, true, -1, 1 << 40, uint64(math.MaxUint64), 1.5, "text", []any{1, "a", []int{}},
+		map[string]any{"a": map[string]any{"b": nil}, "c": []string{"d"}},
+	} {
+		var buf strings.Builder
+		if err := s.Marshal(&buf, v); err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(buf.String()))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v any
+		if err := s.Unmarshal(data, &v); err != nil {
+			return
+		}
+
+		var buf strings.Builder
+		if err := s.Marshal(&buf, v); err != nil {
+			t.Fatalf("Marshal(%#v): %v", v, err)
+		}
+		var got any
+		if err := s.Unmarshal([]byte(buf.String()), &got); err != nil {
+			t.Fatalf("Unmarshal(%x): %v", buf.String(), err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("round trip = %#v, want %#v", got, v)
+		}
+	})
+}
+
+func TestRecursiveSchema(t *testing.T) {
+	r := router.New().OpenAPI("/docs")
+	router.Get(r, "/tree", func(*router.ContextAny) (treeNode, error) { return treeNode{}, nil })
+	router.Get(r, "/list", func(*router.ContextAny) (listNode, error) { return listNode{}, nil })
+	router.Get(r, "/graph", func(*router.ContextAny) (graphNode, error) { return graphNode{}, nil })
+
+	const prefix = "#/components/schemas/"
+	const pkg = "go.grass.garden/router_test."
+	schemas := r.Schema().Components.Schemas
+	for _, name := range []string{"treeNode", "listNode", "graphNode", "graphEdge"} {
+		if _, ok := schemas.Get(pkg + name); !ok {
+			t.Fatalf("missing %s schema", name)
+		}
+	}
+
+	children := schemas.Value(pkg + "treeNode").Schema().Properties.Value("children")
+	if ref := children.Schema().Items.A.GetReference(); ref != prefix+pkg+"treeNode" {
+		t.Errorf("treeNode children items = %q", ref)
+	}
+	next := schemas.Value(pkg + "listNode").Schema().Properties.Value("next")
+	if ref := next.Schema().OneOf[0].GetReference(); ref != prefix+pkg+"listNode" {
+		t.Errorf("listNode next = %q", ref)
+	}
+	edges := schemas.Value(pkg + "graphNode").Schema().Properties.Value("edges")
+	if ref := edges.Schema().Items.A.GetReference(); ref != prefix+pkg+"graphEdge" {
+		t.Errorf("graphNode edges items = %q", ref)
+	}
+	to := schemas.Value(pkg + "graphEdge").Schema().Properties.Value("to")
+	if ref := to.Schema().OneOf[0].GetReference(); ref != prefix+pkg+"graphNode" {
+		t.Errorf("graphEdge to = %q", ref)
+	}
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/docs/openapi.json", nil))
+	if res.Code != http.StatusOK || !json.Valid(res.Body.Bytes()) {
+		t.Errorf("openapi.json status = %d, valid = %v", res.Code, json.Valid(res.Body.Bytes()))
+	}
+}
+
+func TestSchemaAnnotations(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+	type account struct {
+		ID       string   `json:"id" description:"Account identifier" format:"uuid" readOnly:"true"`
+		Name     string   `json:"name" minLength:"1" maxLength:"64" pattern:"^[a-z]+$" example:"123"`
+		Age      int      `json:"age" minimum:"1" maximum:"150" default:"18"`
+		Plan     string   `json:"plan" enum:"free|pro" default:"free"`
+		Password string   `json:"password" writeOnly:"true"`
+		Legacy   bool     `json:"legacy" deprecated:"true"`
+		Tags     []string `json:"tags" example:"[\"a\", \"b\"]"`
+		Address  address  `json:"address" description:"Billing address"`
+		Verbose  bool     `query:"verbose" description:"Include details"`
+	}
+
+	r := router.New()
+	router.Post(r, "/accounts", func(ctx *router.Context[account]) (string, error) {
+		_, err := ctx.GetBody()
+		return "", err
+	})
+
+	data, err := r.Schema().RenderJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths      map[string]map[string]struct{ Parameters []map[string]any }
+		Components struct {
+			Schemas map[string]struct{ Properties map[string]map[string]any }
+		}
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	props := doc.Components.Schemas["go.grass.garden/router_test.account"].Properties
+	tests := []struct {
+		prop, keyword string
+		want          any
+	}{
+		{"id", "description", "Account identifier"},
+		{"id", "format", "uuid"},
+		{"id", "readOnly", true},
+		{"name", "minLength", 1.0},
+		{"name", "maxLength", 64.0},
+		{"name", "pattern", "^[a-z]+$"},
+		{"name", "example", "123"},
+		{"age", "minimum", 1.0},
+		{"age", "maximum", 150.0},
+		{"age", "default", 18.0},
+		{"plan", "enum", []any{"free", "pro"}},
+		{"plan", "default", "free"},
+		{"password", "writeOnly", true},
+		{"legacy", "deprecated", true},
+		{"tags", "example", []any{"a", "b"}},
+		{"address", "description", "Billing address"},
+		{"address", "allOf", []any{map[string]any{"$ref": "#/components/schemas/go.grass.garden/router_test.address"}}},
+	}
+	for _, test := range tests {
+		if got := props[test.prop][test.keyword]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s.%s = %#v, want %#v", test.prop, test.keyword, got, test.want)
+		}
+	}
+
+	params := doc.Paths["/accounts"]["post"].Parameters
+	if len(params) != 1 || params[0]["description"] != "Include details" {
+		t.Errorf("parameters = %v, want verbose with a description", params)
+	}
+
+	errorProps := doc.Components.Schemas["go.grass.garden/router.HTTPError"].Properties
+	if got := errorProps["status"]["example"]; got != 404.0 {
+		t.Errorf("HTTPError status example = %v, want 404", got)
+	}
+
+	// documented constraints are enforced
+	body := `{"name":"Ada","age":200,"plan":"gold"}`
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(body)))
+	var httpErr router.HTTPError
+	if err := json.NewDecoder(res.Body).Decode(&httpErr); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range httpErr.Errors {
+		got = append(got, item.Name+":"+item.Metadata["rule"].(string))
+	}
+	if want := []string{"name:pattern", "age:max", "plan:enum"}; res.Code != http.StatusUnprocessableEntity || !slices.Equal(got, want) {
+		t.Errorf("response = %d %v, want 422 %v", res.Code, got, want)
+	}
+}
+
+func TestRequiredNullable(t *testing.T) {
+	type owner struct {
+		Name string `json:"name"`
+	}
+	type pet struct {
+		Name  string   `json:"name"`
+		Nick  string   `json:"nick,omitempty"`
+		Tags  []string `json:"tags,omitzero"`
+		Age   *int     `json:"age"`
+		Note  string   `json:"note" required:"false"`
+		Chip  *string  `json:"chip" required:"true"`
+		Owner *owner   `json:"owner"`
+	}
+
+	r := router.New()
+	router.Get(r, "/pet", func(*router.ContextAny) (pet, error) { return pet{}, nil })
+
+	data, err := r.Schema().RenderJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string
+				Properties map[string]map[string]any
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := doc.Components.Schemas["go.grass.garden/router_test.pet"]
+	if want := []string{"name", "chip"}; !slices.Equal(schema.Required, want) {
+		t.Errorf("required = %v, want %v", schema.Required, want)
+	}
+	if got, want := schema.Properties["age"]["type"], []any{"integer", "null"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("age type = %v, want %v", got, want)
+	}
+	if got := schema.Properties["name"]["type"]; got != "string" {
+		t.Errorf("name type = %v, want string", got)
+	}
+	want := []any{
+		map[string]any{"$ref": "#/components/schemas/go.grass.garden/router_test.owner"},
+		map[string]any{"type": "null"},
+	}
+	if got := schema.Properties["owner"]["oneOf"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("owner oneOf = %v, want %v", got, want)
+	}
+}
+
+type testUUID [16]byte
+
+func (u testUUID) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])), nil
+}
+
+type money struct {
+	Cents int64
+}
+
+func TestTypeSchemas(t *testing.T) {
+	type record struct {
+		Time     time.Time       `json:"time"`
+		Optional *time.Time      `json:"optional"`
+		Duration time.Duration   `json:"duration"`
+		Bytes    []byte          `json:"bytes"`
+		Raw      json.RawMessage `json:"raw"`
+		Number   json.Number     `json:"number"`
+		Big      *big.Int        `json:"big"`
+		IP       net.IP          `json:"ip"`
+		URL      url.URL         `json:"url"`
+		ID       testUUID        `json:"id"`
+		Price    money           `json:"price"`
+	}
+
+	r := router.New(router.WithTypeSchema[money](func() *base.Schema {
+		return &base.Schema{Type: []string{"string"}, Pattern: `^\d+\.\d{2}$`}
+	}))
+	router.Get(r, "/record", func(*router.ContextAny) (record, error) { return record{}, nil })
+
+	data, err := r.Schema().RenderJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct{ Properties map[string]map[string]any }
+		}
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	props := doc.Components.Schemas["go.grass.garden/router_test.record"].Properties
+	tests := []struct {
+		prop   string
+		typ    any
+		format any
+	}{
+		{"time", "string", "date-time"},
+		{"optional", []any{"string", "null"}, "date-time"},
+		{"duration", "integer", "int64"},
+		{"bytes", "string", "byte"},
+		{"raw", nil, nil},
+		{"number", "number", nil},
+		{"big", []any{"integer", "null"}, nil},
+		{"ip", "string", nil},
+		{"id", "string", "uuid"},
+		{"price", "string", nil},
+	}
+	for _, test := range tests {
+		prop := props[test.prop]
+		if !reflect.DeepEqual(prop["type"], test.typ) || prop["format"] != test.format {
+			t.Errorf("%s = %v, want type %v and format %v", test.prop, prop, test.typ, test.format)
+		}
+	}
+	// url.URL has no text encoding, it is sent as an object
+	if ref := props["url"]["$ref"]; ref != "#/components/schemas/net/url.URL" {
+		t.Errorf("url = %v, want a reference to the url.URL object", props["url"])
+	}
+	if props["price"]["pattern"] != `^\d+\.\d{2}$` {
+		t.Errorf("price = %v, want the registered schema", props["price"])
+	}
+	if _, ok := doc.Components.Schemas["go.grass.garden/router_test.money"]; ok {
+		t.Error("registered type should not be a component")
+	}
+
+	// type schemas belong to the router they are set on
+	other := router.New()
+	router.Get(other, "/price", func(*router.ContextAny) (money, error) { return money{}, nil })
+	if _, ok := other.Schema().Components.Schemas.Get("go.grass.garden/router_test.money"); !ok {
+		t.Error("type schema of another router was used")
+	}
+}
+
+type celsius struct {
+	degrees float64
+}
+
+func (c celsius) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.degrees)
+}
+
+func (celsius) Schema() *base.Schema {
+	return &base.Schema{Type: []string{"number"}, Description: "Degrees Celsius"}
+}
+
+type level struct {
+	Name string
+}
+
+func (l *level) MarshalText() ([]byte, error) {
+	return []byte(l.Name), nil
+}
+
+type grade struct {
+	Value int
+}
+
+func (g grade) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(g.Value)), nil
+}
+
+type point struct {
+	X int `json:"x"`
+}
+
+func (p point) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(p.X)), nil
+}
+
+func (p point) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]int{p.X})
+}
+
+func TestSchemaProvider(t *testing.T) {
+	type reading struct {
+		Temperature celsius `json:"temperature"`
+		Level       level   `json:"level"`
+		LevelPtr    *level  `json:"levelPtr"`
+		Levels      []level `json:"levels"`
+		Grade       grade   `json:"grade"`
+		Point       point   `json:"point"`
+	}
+
+	r := router.New()
+	router.Get(r, "/reading", func(*router.ContextAny) (reading, error) { return reading{}, nil })
+
+	data, err := r.Schema().RenderJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct{ Properties map[string]map[string]any }
+		}
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	props := doc.Components.Schemas["go.grass.garden/router_test.reading"].Properties
+	if got := props["temperature"]; got["type"] != "number" || got["description"] != "Degrees Celsius" {
+		t.Errorf("temperature = %v, want the provided schema", got)
+	}
+	if got := props["grade"]; got["type"] != "string" {
+		t.Errorf("grade = %v, want a string", got)
+	}
+	if got := props["point"]; len(got) != 0 {
+		t.Errorf("point = %v, want any value for a json.Marshaler", got)
+	}
+
+	// pointer methods are only called on addressable values, such as values
+	// behind pointers and slice elements
+	if got := props["level"]["$ref"]; got != "#/components/schemas/go.grass.garden/router_test.level" {
+		t.Errorf("level = %v, want the struct layout", props["level"])
+	}
+	if got := props["levelPtr"]["type"]; !reflect.DeepEqual(got, []any{"string", "null"}) {
+		t.Errorf("levelPtr = %v, want a nullable string", props["levelPtr"])
+	}
+	if got := props["levels"]["items"]; !reflect.DeepEqual(got, map[string]any{"type": "string"}) {
+		t.Errorf("levels = %v, want an array of strings", props["levels"])
+	}
+	data, _ = json.Marshal(reading{Level: level{"a"}, LevelPtr: &level{"b"}, Levels: []level{{"c"}}, Grade: grade{2}})
+	if want := `"level":{"Name":"a"},"levelPtr":"b","levels":["c"],"grade":"2"`; !strings.Contains(string(data), want) {
+		t.Errorf("json = %s, want it to contain %s", data, want)
+	}
+}
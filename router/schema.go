@@ -1,60 +1,297 @@
 package router
 
 import (
+	"encoding"
+	"encoding/json"
+	"math/big"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/netip"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pb33f/libopenapi/datamodel/high/base"
 	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
 	"github.com/pb33f/libopenapi/orderedmap"
 	typetostring "github.com/samber/go-type-to-string"
 	"go.grass.garden/utils"
+	"gopkg.in/yaml.v3"
 )
 
 func (r *route[Input, Output, Ctx]) Operation() *v3.Operation {
 	operation := &v3.Operation{
-		OperationId: r.operationId,
-		Summary:     r.summary,
-		Description: r.description,
+		OperationId:  r.operationId,
+		Summary:      r.summary,
+		Description:  r.description,
+		Tags:         r.tags,
+		ExternalDocs: r.externalDocs,
+		Extensions:   r.extensions,
+	}
+	if r.deprecated {
+		operation.Deprecated = utils.ToPointer(true)
 	}
 
 	// Input
+	root := r.router.root()
 	inputType := reflect.TypeOf((*Input)(nil)).Elem()
+	operation.Parameters = root.parameters(inputType)
+	requestContent := orderedmap.New[string, *v3.MediaType]()
+	var inputSchema, inputFormSchema *base.SchemaProxy
+	for _, contentType := range r.consumes {
+		// forms are bound from the fields tagged with form
+		if contentType == contentTypeMultipart || contentType == contentTypeForm {
+			if inputFormSchema == nil {
+				inputFormSchema = root.formSchema(inputType)
+			}
+			requestContent.Set(contentType, &v3.MediaType{Schema: inputFormSchema})
+			continue
+		}
+		if inputSchema == nil {
+			inputSchema = root.walk(inputType)
+		}
+		requestContent.Set(contentType, &v3.MediaType{Schema: inputSchema})
+	}
 	operation.RequestBody = &v3.RequestBody{
 		Required:    utils.ToPointer(true),
 		Description: http.StatusText(r.statusCode),
-		Content: orderedmap.FromPairs(
-			orderedmap.NewPair(
-				r.contentType, &v3.MediaType{
-					Schema: walk(r.router.doc, operation, inputType),
-				},
-			),
-		),
+		Content:     requestContent,
 	}
 
-	// Output
+	// Output, streams describe their elements
 	outputType := reflect.TypeOf((*Output)(nil)).Elem()
+	if r.stream != nil {
+		outputType = r.stream
+	}
+	outputSchema := root.walk(outputType)
+	errorSchema := root.walk(reflect.TypeOf((*HTTPError)(nil)).Elem())
+	responseContent := orderedmap.New[string, *v3.MediaType]()
+	errorContent := orderedmap.New[string, *v3.MediaType]()
+	for _, contentType := range r.produces {
+		schema := outputSchema
+		if r.stream != nil && contentType == contentTypeJson {
+			schema = base.CreateSchemaProxy(&base.Schema{
+				Type:  []string{"array"},
+				Items: &base.DynamicValue[*base.SchemaProxy, bool]{A: outputSchema},
+			})
+		}
+		responseContent.Set(contentType, &v3.MediaType{Schema: schema})
+	}
+	problemContentTypes := r.router.problemContentTypes()
+	for _, contentType := range problemContentTypes {
+		errorContent.Set(contentType, &v3.MediaType{Schema: errorSchema})
+	}
 	operation.Responses = &v3.Responses{
 		Codes: orderedmap.FromPairs(
 			orderedmap.NewPair(strconv.Itoa(r.statusCode), &v3.Response{
-				Content: orderedmap.FromPairs(orderedmap.NewPair(r.contentType, &v3.MediaType{
-					Schema: walk(r.router.doc, operation, outputType),
-				})),
+				Description: http.StatusText(r.statusCode),
+				Content:     responseContent,
 			}),
 		),
 		Default: &v3.Response{
-			Content: orderedmap.FromPairs(orderedmap.NewPair(r.contentType, &v3.MediaType{
-				Schema: walk(r.router.doc, operation, reflect.TypeOf((*HTTPError)(nil)).Elem()),
-			})),
+			Description: "Problem details as defined by RFC 9457",
+			Content:     errorContent,
 		},
 	}
 
+	for _, res := range r.responses {
+		response := &v3.Response{Description: res.description}
+		if response.Description == "" {
+			response.Description = http.StatusText(res.code)
+		}
+		if res.body != nil {
+			schema := root.walk(res.body)
+			response.Content = orderedmap.New[string, *v3.MediaType]()
+			for _, contentType := range r.produces {
+				response.Content.Set(contentType, &v3.MediaType{Schema: schema})
+			}
+		}
+		operation.Responses.Codes.Set(strconv.Itoa(res.code), response)
+	}
+
+	for _, code := range errorStatusCodes(r.errors) {
+		examples := orderedmap.New[string, *base.Example]()
+		for _, err := range r.errors {
+			if err.StatusCode() != code {
+				continue
+			}
+			name := reflect.TypeOf(err).Name()
+			if _, present := examples.Get(name); present {
+				name += "-" + strconv.Itoa(examples.Len()+1)
+			}
+			examples.Set(name, &base.Example{
+				Summary: http.StatusText(code),
+				Value:   exampleNode(r.errorProcessor(err)),
+			})
+		}
+
+		response := &v3.Response{
+			Description: http.StatusText(code),
+			Content:     orderedmap.New[string, *v3.MediaType](),
+		}
+		for _, contentType := range problemContentTypes {
+			response.Content.Set(contentType, &v3.MediaType{Schema: errorSchema, Examples: examples})
+		}
+		operation.Responses.Codes.Set(strconv.Itoa(code), response)
+	}
+
 	return operation
 }
 
-func walk(doc *v3.Document, op *v3.Operation, t reflect.Type) *base.SchemaProxy {
+// errorStatusCodes returns the distinct status codes of errs, sorted.
+func errorStatusCodes(errs []Error) []int {
+	codes := make([]int, 0, len(errs))
+	for _, err := range errs {
+		codes = append(codes, err.StatusCode())
+	}
+	slices.Sort(codes)
+	return slices.Compact(codes)
+}
+
+// exampleNode converts v to a YAML node through its JSON representation, so
+// that examples use the same field names as the serialized payloads.
+func exampleNode(v any) *yaml.Node {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil || len(node.Content) == 0 {
+		return nil
+	}
+	return node.Content[0]
+}
+
+// defaultTypeSchemas documents well-known types whose structure does not
+// match their encoding. WithTypeSchema adds to them.
+func defaultTypeSchemas() map[reflect.Type]func() *base.Schema {
+	return map[reflect.Type]func() *base.Schema{
+		reflect.TypeFor[time.Time](): func() *base.Schema {
+			return &base.Schema{Type: []string{"string"}, Format: "date-time"}
+		},
+		reflect.TypeFor[time.Duration](): func() *base.Schema {
+			// encoding/json writes durations as nanoseconds
+			return &base.Schema{Type: []string{"integer"}, Format: "int64", Description: "Duration in nanoseconds"}
+		},
+		reflect.TypeFor[[]byte](): func() *base.Schema {
+			return &base.Schema{Type: []string{"string"}, Format: "byte"}
+		},
+		reflect.TypeFor[json.RawMessage](): func() *base.Schema {
+			return &base.Schema{}
+		},
+		reflect.TypeFor[json.Number](): func() *base.Schema {
+			return &base.Schema{Type: []string{"number"}}
+		},
+		reflect.TypeFor[big.Int](): func() *base.Schema {
+			return &base.Schema{Type: []string{"integer"}}
+		},
+		reflect.TypeFor[net.IP]():     ipSchema,
+		reflect.TypeFor[netip.Addr](): ipSchema,
+		reflect.TypeFor[multipart.FileHeader](): func() *base.Schema {
+			return &base.Schema{Type: []string{"string"}, Format: "binary"}
+		},
+	}
+}
+
+func ipSchema() *base.Schema {
+	return &base.Schema{Type: []string{"string"}, AnyOf: []*base.SchemaProxy{
+		base.CreateSchemaProxy(&base.Schema{Format: "ipv4"}),
+		base.CreateSchemaProxy(&base.Schema{Format: "ipv6"}),
+	}}
+}
+
+var (
+	schemaProviderType = reflect.TypeFor[SchemaProvider]()
+	textMarshalerType  = reflect.TypeFor[encoding.TextMarshaler]()
+	jsonMarshalerType  = reflect.TypeFor[json.Marshaler]()
+)
+
+// SchemaProvider is implemented by types documenting their own schema, such
+// as json.Marshaler types, which are otherwise documented as any value.
+// Schema is called on a zero value and must return a new schema on every
+// call. Marshalers keeping the layout of their fields may return nil to be
+// documented by their fields, like HTTPError.
+type SchemaProvider interface {
+	Schema() *base.Schema
+}
+
+// implements reports whether values of type t, or pointers to them,
+// implement the interface type iface.
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// providedSchema returns the schema of types implementing SchemaProvider, or
+// encoded by their own marshaler.
+func providedSchema(t reflect.Type) *base.Schema {
+	if t.Kind() == reflect.Interface || t.Kind() == reflect.Ptr {
+		return nil
+	}
+
+	if implements(t, schemaProviderType) {
+		return reflect.New(t).Interface().(SchemaProvider).Schema()
+	}
+	return marshalerSchema(t)
+}
+
+// marshalerSchema returns the schema of types encoded by their own
+// marshaler: any value for json.Marshaler, since its output is unknown, and
+// strings for encoding.TextMarshaler. Only the method set of t counts:
+// encoding/json calls pointer methods on addressable values only, which
+// walkAddressable documents by passing a pointer type.
+func marshalerSchema(t reflect.Type) *base.Schema {
+	switch {
+	case implements(indirect(t), schemaProviderType):
+		// providers returning no schema are documented by their fields
+		return nil
+	case t.Implements(jsonMarshalerType):
+		return &base.Schema{}
+	case t.Implements(textMarshalerType):
+		return &base.Schema{Type: []string{"string"}}
+	default:
+		return nil
+	}
+}
+
+// mappedSchema returns the registered schema of t, if any. Byte arrays of 16
+// bytes that marshal to text are documented as UUIDs.
+func (r *Router) mappedSchema(t reflect.Type) *base.Schema {
+	if schema, ok := r.typeSchemas[t]; ok {
+		return schema()
+	}
+
+	if t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8 &&
+		t.Implements(textMarshalerType) {
+		return &base.Schema{Type: []string{"string"}, Format: "uuid"}
+	}
+	return nil
+}
+
+// walkAddressable walks the type of addressable values, such as slice
+// elements and values behind pointers, on which encoding/json also calls
+// the marshalers of pointers. Struct schemas are shared by every use of
+// their type, so their fields are walked as if they were not addressable.
+func (r *Router) walkAddressable(t reflect.Type) *base.SchemaProxy {
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && r.mappedSchema(t) == nil && providedSchema(t) == nil {
+		if marshaled := marshalerSchema(reflect.PointerTo(t)); marshaled != nil {
+			return base.CreateSchemaProxy(marshaled)
+		}
+	}
+	return r.walk(t)
+}
+
+func (r *Router) walk(t reflect.Type) *base.SchemaProxy {
+	if mapped := r.mappedSchema(t); mapped != nil {
+		return base.CreateSchemaProxy(mapped)
+	}
+	if provided := providedSchema(t); provided != nil {
+		return base.CreateSchemaProxy(provided)
+	}
+
 	s := &base.Schema{}
 	proxy := base.CreateSchemaProxy(s)
 	s.Properties = orderedmap.New[string, *base.SchemaProxy]()
@@ -84,20 +321,23 @@ func walk(doc *v3.Document, op *v3.Operation, t reflect.Type) *base.SchemaProxy
 		s.MinItems = utils.ToPointer(int64(t.Len()))
 		s.MaxItems = utils.ToPointer(int64(t.Len()))
 		s.Items = &base.DynamicValue[*base.SchemaProxy, bool]{
-			A: walk(doc, op, t.Elem()),
+			A: r.walkAddressable(t.Elem()),
 		}
 	case reflect.Slice:
 		s.Type = append(s.Type, "array")
 		s.Items = &base.DynamicValue[*base.SchemaProxy, bool]{
-			A: walk(doc, op, t.Elem()),
+			A: r.walkAddressable(t.Elem()),
 		}
 	case reflect.Map:
 		s.Type = append(s.Type, "object")
 		s.AdditionalProperties = &base.DynamicValue[*base.SchemaProxy, bool]{
-			A: walk(doc, op, t.Elem()),
+			A: r.walk(t.Elem()),
 		}
 	case reflect.Ptr:
-		return walk(doc, op, t.Elem())
+		if t.Elem() == fileHeaderType {
+			return r.walk(t.Elem())
+		}
+		return nullable(r.walkAddressable(t.Elem()))
 	case reflect.Interface:
 		s.Type = append(s.Type, "object")
 		s.AdditionalProperties = &base.DynamicValue[*base.SchemaProxy, bool]{
@@ -106,35 +346,289 @@ func walk(doc *v3.Document, op *v3.Operation, t reflect.Type) *base.SchemaProxy
 		}
 	case reflect.Struct:
 		sft := typeToString(t)
-		_, present := doc.Components.Schemas.Get(sft)
+		_, present := r.doc.Components.Schemas.Get(sft)
 		if present {
 			return base.CreateSchemaProxyRef(componentSchemaRef(t))
 		}
 
+		// register the schema before walking the fields, so that fields of
+		// recursive types refer to it instead of walking it again
+		r.doc.Components.Schemas.Set(sft, proxy)
+
 		s.Type = append(s.Type, "object")
 		for i := 0; i < t.NumField(); i++ {
-			if f := t.Field(i); f.IsExported() {
-				nsp := walk(doc, op, f.Type)
-				params := structPropToParams(f, nsp)
-				if len(params) > 0 {
-					op.Parameters = append(op.Parameters, params...)
-				} else if name, skip := propName(f); !skip {
-					s.Properties.Set(name, nsp)
+			f := t.Field(i)
+			if !f.IsExported() || isParam(f) {
+				continue
+			}
+			if name, skip := propName(f); !skip {
+				nsp, rules := r.fieldSchema(f)
+				s.Properties.Set(name, nsp)
+				if isRequired(f, rules, "json", formTag) {
+					s.Required = append(s.Required, name)
 				}
 			}
 		}
 
 		if s.Properties.Len() == 0 {
+			r.doc.Components.Schemas.Delete(sft)
 			return nil
 		}
 
-		doc.Components.Schemas.Set(sft, proxy)
 		return base.CreateSchemaProxyRef(componentSchemaRef(t))
 	}
 
 	return proxy
 }
 
+// nullable allows null in addition to the values of a schema, using the
+// type array of OpenAPI 3.1. References are combined with the null type in a
+// oneOf.
+func nullable(proxy *base.SchemaProxy) *base.SchemaProxy {
+	if proxy == nil {
+		return nil
+	}
+
+	if proxy.IsReference() {
+		return base.CreateSchemaProxy(&base.Schema{OneOf: []*base.SchemaProxy{
+			proxy,
+			base.CreateSchemaProxy(&base.Schema{Type: []string{"null"}}),
+		}})
+	}
+
+	// schemas without a type, such as the one of interfaces, accept null
+	s := proxy.Schema()
+	if len(s.Type) > 0 && !slices.Contains(s.Type, "null") {
+		s.Type = append(s.Type, "null")
+	}
+	return proxy
+}
+
+// tagBool reports whether the struct tag name of sf is set to a true value
+// accepted by strconv.ParseBool.
+func tagBool(sf reflect.StructField, name string) bool {
+	b, err := strconv.ParseBool(sf.Tag.Get(name))
+	return err == nil && b
+}
+
+// isRequired reports whether a struct field is a required property of its
+// schema. The required tag decides when present. Otherwise, fields are
+// required when they have a required validate rule, or when they are always
+// serialized: they are not pointers and the first of tags they have is not
+// tagged omitempty or omitzero.
+func isRequired(sf reflect.StructField, rules []rule, tags ...string) bool {
+	if v, ok := sf.Tag.Lookup("required"); ok {
+		if required, err := strconv.ParseBool(v); err == nil {
+			return required
+		}
+	}
+
+	if hasRule(rules, "required") {
+		return true
+	}
+	if sf.Type.Kind() == reflect.Ptr {
+		return false
+	}
+
+	for _, tag := range tags {
+		if v, ok := sf.Tag.Lookup(tag); ok {
+			_, opts, _ := strings.Cut(v, ",")
+			for _, opt := range strings.Split(opts, ",") {
+				if opt == "omitempty" || opt == "omitzero" {
+					return false
+				}
+			}
+			break
+		}
+	}
+	return true
+}
+
+// annotationTags are the struct tags annotating the schema of a field.
+var annotationTags = []string{
+	"description", "example", "default", "enum", "format",
+	"minimum", "maximum", "minLength", "maxLength", "pattern",
+	"deprecated", "readOnly", "writeOnly",
+}
+
+// annotate applies the annotation tags of a struct field to its schema. Enum
+// values are separated by |, like in validate tags. Since a reference cannot
+// carry other keywords, annotated references are wrapped in an allOf. The
+// constraints among them are enforced like validate rules.
+func annotate(proxy *base.SchemaProxy, tag reflect.StructTag) *base.SchemaProxy {
+	if proxy == nil || !slices.ContainsFunc(annotationTags, func(name string) bool {
+		_, ok := tag.Lookup(name)
+		return ok
+	}) {
+		return proxy
+	}
+
+	s := proxy.Schema()
+	if proxy.IsReference() {
+		s = &base.Schema{AllOf: []*base.SchemaProxy{proxy}}
+		proxy = base.CreateSchemaProxy(s)
+	}
+
+	kind := ""
+	if len(s.Type) > 0 {
+		kind = s.Type[0]
+	}
+
+	for _, name := range annotationTags {
+		value, ok := tag.Lookup(name)
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "description":
+			s.Description = value
+		case "example":
+			s.Example = valueNode(kind, value)
+		case "default":
+			s.Default = valueNode(kind, value)
+		case "enum":
+			s.Enum = nil
+			for _, e := range strings.Split(value, "|") {
+				s.Enum = append(s.Enum, valueNode(kind, e))
+			}
+		case "format":
+			s.Format = value
+		case "pattern":
+			s.Pattern = value
+		case "minimum", "maximum":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			if name == "minimum" {
+				s.Minimum = utils.ToPointer(n)
+			} else {
+				s.Maximum = utils.ToPointer(n)
+			}
+		case "minLength", "maxLength":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			if name == "minLength" {
+				s.MinLength = utils.ToPointer(n)
+			} else {
+				s.MaxLength = utils.ToPointer(n)
+			}
+		case "deprecated", "readOnly", "writeOnly":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				continue
+			}
+			switch name {
+			case "deprecated":
+				s.Deprecated = utils.ToPointer(b)
+			case "readOnly":
+				s.ReadOnly = utils.ToPointer(b)
+			case "writeOnly":
+				s.WriteOnly = utils.ToPointer(b)
+			}
+		}
+	}
+
+	return proxy
+}
+
+// valueNode parses the value of an example, default or enum tag. Values of
+// string schemas are kept as strings, others are parsed as YAML, which also
+// accepts JSON arrays and objects.
+func valueNode(kind, value string) *yaml.Node {
+	if kind == "string" {
+		return scalarNode(kind, value)
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &node); err != nil || len(node.Content) == 0 {
+		return scalarNode("string", value)
+	}
+	return node.Content[0]
+}
+
+// fieldSchema returns the schema of a struct field, with the constraints of
+// its validate tag and its annotations, along with its validate rules.
+func (r *Router) fieldSchema(f reflect.StructField) (*base.SchemaProxy, []rule) {
+	proxy := r.walk(f.Type)
+	if proxy == nil {
+		// structs without exported fields are encoded as empty objects
+		proxy = base.CreateSchemaProxy(&base.Schema{Type: []string{"object"}})
+	}
+	rules, _ := parseRules(f.Tag.Get(validateTag))
+	if proxy != nil && !proxy.IsReference() {
+		applyRules(proxy.Schema(), rules)
+	}
+	return annotate(proxy, f.Tag), rules
+}
+
+// formSchema returns the schema of form request bodies bound to t, whose
+// properties are the fields tagged with form.
+func (r *Router) formSchema(t reflect.Type) *base.SchemaProxy {
+	s := &base.Schema{
+		Type:       []string{"object"},
+		Properties: orderedmap.New[string, *base.SchemaProxy](),
+	}
+
+	t = indirect(t)
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get(formTag), ",")
+			if !f.IsExported() || name == "" || name == "-" {
+				continue
+			}
+
+			nsp, rules := r.fieldSchema(f)
+			s.Properties.Set(name, nsp)
+			if isRequired(f, rules, formTag) {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+	return base.CreateSchemaProxy(s)
+}
+
+// isParam reports whether a struct field is bound from a request parameter
+// rather than from the request body.
+func isParam(f reflect.StructField) bool {
+	return slices.ContainsFunc(paramLocations, func(in string) bool {
+		return f.Tag.Get(in) != ""
+	})
+}
+
+// parameters documents the fields of an input type bound by bindParams. They
+// are collected on every call, independently of the component registered for
+// the type.
+func (r *Router) parameters(t reflect.Type) []*v3.Parameter {
+	t = indirect(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []*v3.Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || !isParam(f) {
+			continue
+		}
+
+		schema, rules := r.fieldSchema(f)
+		for _, p := range structPropToParams(f, schema) {
+			p.Description = f.Tag.Get("description")
+			p.Deprecated = tagBool(f, "deprecated")
+			if hasRule(rules, "required") || tagBool(f, "required") {
+				p.Required = utils.ToPointer(true)
+			}
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
 func structPropToParams(sf reflect.StructField, schema *base.SchemaProxy) (params []*v3.Parameter) {
 	if v := sf.Tag.Get("header"); v != "" {
 		params = append(params, &v3.Parameter{
@@ -145,9 +639,10 @@ func structPropToParams(sf reflect.StructField, schema *base.SchemaProxy) (param
 	}
 	if v := sf.Tag.Get("path"); v != "" {
 		params = append(params, &v3.Parameter{
-			Name:   v,
-			In:     "path",
-			Schema: schema,
+			Name:     v,
+			In:       "path",
+			Required: utils.ToPointer(true),
+			Schema:   schema,
 		})
 	}
 	if v := sf.Tag.Get("query"); v != "" {
@@ -158,11 +653,18 @@ func structPropToParams(sf reflect.StructField, schema *base.SchemaProxy) (param
 			AllowEmptyValue: true,
 		})
 	}
+	if v := sf.Tag.Get("cookie"); v != "" {
+		params = append(params, &v3.Parameter{
+			Name:   v,
+			In:     "cookie",
+			Schema: schema,
+		})
+	}
 	return params
 }
 
 func propName(sf reflect.StructField) (string, bool) {
-	tags := []string{"json"}
+	tags := []string{"json", formTag}
 	for _, tag := range tags {
 		if name := sf.Tag.Get(tag); name != "" {
 			before, _, _ := strings.Cut(name, ",")
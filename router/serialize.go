@@ -1,11 +1,28 @@
 package router
 
 import (
+	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"net/url"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
 )
 
-var _ Serializer = JSONSerializer{}
+var (
+	_ Serializer = JSONSerializer{}
+	_ Serializer = XMLSerializer{}
+	_ Serializer = YAMLSerializer{}
+	_ Serializer = FormSerializer{}
+	_ Serializer = MessagePackSerializer{}
+	_ Serializer = CBORSerializer{}
+)
 
 type Serializer interface {
 	Marshal(w io.Writer, v any) error
@@ -13,12 +30,39 @@ type Serializer interface {
 	ContentType() string
 }
 
+// defaultSerializers returns the serializers registered by New. The other
+// built-in serializers are registered with WithSerializers.
 func defaultSerializers() map[string]Serializer {
 	return map[string]Serializer{
 		contentTypeJson: JSONSerializer{},
 	}
 }
 
+// toTree converts v to the generic representation of its JSON encoding, so
+// that serializers without struct tags of their own use the same field names
+// as JSON payloads and the OpenAPI schema. Numbers are kept as json.Number.
+func toTree(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&tree)
+	return tree, err
+}
+
+// fromTree stores a generic value in v through its JSON encoding.
+func fromTree(tree any, v any) error {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
 // -----------------
 
 type JSONSerializer struct{}
@@ -34,3 +78,213 @@ func (JSONSerializer) Unmarshal(data []byte, v any) error {
 func (JSONSerializer) ContentType() string {
 	return contentTypeJson
 }
+
+// -----------------
+
+// XMLSerializer encodes values with encoding/xml, following their xml struct
+// tags. Registering it also enables application/problem+xml error responses.
+type XMLSerializer struct{}
+
+func (XMLSerializer) Marshal(w io.Writer, v any) error {
+	// encode into a buffer, so a failure does not commit a partial response
+	buf := bytes.NewBufferString(xml.Header)
+	if err := xml.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func (XMLSerializer) Unmarshal(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
+
+func (XMLSerializer) ContentType() string {
+	return contentTypeXml
+}
+
+// -----------------
+
+// YAMLSerializer encodes values as YAML, using the field names of their JSON
+// encoding.
+type YAMLSerializer struct{}
+
+func (YAMLSerializer) Marshal(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, decoding it into a node keeps the order of fields
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (YAMLSerializer) Unmarshal(data []byte, v any) error {
+	var tree any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	return fromTree(tree, v)
+}
+
+func (YAMLSerializer) ContentType() string {
+	return contentTypeYaml
+}
+
+// -----------------
+
+// FormSerializer encodes structs and maps as URL-encoded forms. Fields are
+// named after their form tag, or like in JSON; slices are encoded as repeated
+// fields and other composite values as JSON. Invalid fields are reported
+// with a BadRequestError, like forms bound without the serializer.
+type FormSerializer struct{}
+
+func (FormSerializer) Marshal(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	form := url.Values{}
+	add := func(name string, fv reflect.Value) error {
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < fv.Len(); i++ {
+				s, err := textValue(fv.Index(i))
+				if err != nil {
+					return err
+				}
+				form.Add(name, s)
+			}
+			return nil
+		}
+
+		if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && fv.IsNil() {
+			return nil
+		}
+		s, err := textValue(fv)
+		if err == nil {
+			form.Add(name, s)
+		}
+		return err
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, skip := formName(f)
+			if skip {
+				continue
+			}
+			if err := add(name, rv.Field(i)); err != nil {
+				return fmt.Errorf("form field %q: %w", name, err)
+			}
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("form: unsupported map key type %s", rv.Type().Key())
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := add(iter.Key().String(), iter.Value()); err != nil {
+				return fmt.Errorf("form field %q: %w", iter.Key().String(), err)
+			}
+		}
+	default:
+		return fmt.Errorf("form: unsupported type %s", rv.Type())
+	}
+
+	_, err := io.WriteString(w, form.Encode())
+	return err
+}
+
+func (FormSerializer) Unmarshal(data []byte, v any) error {
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return BadRequestError{Err: err, Detail: "The form is malformed"}
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("form: Unmarshal requires a non-nil pointer")
+	}
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+
+	var invalid invalidFormFields
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, skip := formName(f)
+			if values := form[name]; !skip && len(values) > 0 {
+				if err := bindValue(rv.Field(i), values); err != nil {
+					invalid.add(name, err)
+				}
+			}
+		}
+		return invalid.err()
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("form: unsupported map key type %s", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for _, name := range slices.Sorted(maps.Keys(form)) {
+			values := form[name]
+			value := reflect.New(rv.Type().Elem()).Elem()
+			if value.Kind() == reflect.Interface {
+				if len(values) == 1 {
+					value.Set(reflect.ValueOf(values[0]))
+				} else {
+					value.Set(reflect.ValueOf(values))
+				}
+			} else if err := bindValue(value, values); err != nil {
+				invalid.add(name, err)
+				continue
+			}
+			rv.SetMapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()), value)
+		}
+		return invalid.err()
+	case reflect.Interface:
+		rv.Set(reflect.ValueOf(map[string][]string(form)))
+		return nil
+	default:
+		return fmt.Errorf("form: unsupported type %s", rv.Type())
+	}
+}
+
+func (FormSerializer) ContentType() string {
+	return contentTypeForm
+}
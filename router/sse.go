@@ -0,0 +1,219 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	contentTypeEventStream = "text/event-stream"
+
+	defaultHeartbeat = 15 * time.Second
+)
+
+// ErrStreamClosed is returned when sending on a stream whose handler has
+// returned.
+var ErrStreamClosed = errors.New("router: stream closed")
+
+type SSEHandler[I, E any, Ctx ctx[I]] func(Ctx, *EventSender[E]) error
+
+// Event is a server-sent event. Data is encoded with the route's serializer,
+// JSON by default.
+type Event[T any] struct {
+	ID    string
+	Name  string
+	Data  T
+	Retry time.Duration
+}
+
+// EventSender writes server-sent events to the response. The status line and
+// headers are sent with the first event, so a handler may still return an
+// error response before that. It is safe for concurrent use.
+type EventSender[T any] struct {
+	mu         sync.Mutex
+	ctx        *ContextAny
+	serializer Serializer
+	started    bool
+	heartbeat  *time.Ticker
+	stop       chan struct{}
+}
+
+// SSE registers a GET route streaming server-sent events. The handler returns
+// when the stream ends; it should also return when the client disconnects,
+// which closes ctx.Done(). Comments are sent as heartbeats every 15 seconds
+// until changed with EventSender.Heartbeat.
+func SSE[Input, E any, Ctx ctx[Input]](
+	r *Router,
+	pattern string,
+	handler SSEHandler[Input, E, Ctx],
+) *route[Input, E, Ctx] {
+	var ro *route[Input, E, Ctx]
+	ro = newRoute(r, http.MethodGet, pattern, func(ctx Ctx) (E, error) {
+		var zero E
+		sender := newEventSender[E](ctx.contextAny(), ro.serializer)
+		defer sender.close()
+
+		if err := handler(ctx, sender); err != nil {
+			return zero, err
+		}
+		return zero, sender.start()
+	})
+
+	ro.contentType = contentTypeEventStream
+	ro.produces = []string{contentTypeEventStream}
+	ro.statusCode = http.StatusOK
+	r.addRoute(ro)
+	return ro
+}
+
+func newEventSender[T any](ctx *ContextAny, serializer Serializer) *EventSender[T] {
+	s := &EventSender[T]{
+		ctx:        ctx,
+		serializer: serializer,
+		heartbeat:  time.NewTicker(defaultHeartbeat),
+		stop:       make(chan struct{}),
+	}
+	go s.heartbeats()
+	return s
+}
+
+// LastEventID returns the Last-Event-ID header sent by a reconnecting client.
+func (s *EventSender[T]) LastEventID() string {
+	return s.ctx.Header("Last-Event-ID")
+}
+
+func (s *EventSender[T]) Send(data T) error {
+	return s.SendEvent(Event[T]{Data: data})
+}
+
+func (s *EventSender[T]) SendEvent(e Event[T]) error {
+	var data bytes.Buffer
+	if err := s.serializer.Marshal(&data, e.Data); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if e.ID != "" {
+		writeField(&buf, "id", e.ID)
+	}
+	if e.Name != "" {
+		writeField(&buf, "event", e.Name)
+	}
+	if e.Retry > 0 {
+		writeField(&buf, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	for _, line := range strings.Split(strings.TrimRight(data.String(), "\r\n"), "\n") {
+		buf.WriteString("data: ")
+		buf.WriteString(strings.TrimSuffix(line, "\r"))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	return s.write(buf.Bytes())
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (s *EventSender[T]) Retry(d time.Duration) error {
+	return s.write([]byte("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n"))
+}
+
+// Comment sends a comment line, which clients ignore.
+func (s *EventSender[T]) Comment(text string) error {
+	var buf bytes.Buffer
+	for _, line := range strings.Split(text, "\n") {
+		buf.WriteString(": ")
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Heartbeat changes the interval of heartbeat comments. A non-positive
+// interval disables them.
+func (s *EventSender[T]) Heartbeat(interval time.Duration) {
+	if interval <= 0 {
+		s.heartbeat.Stop()
+		return
+	}
+	s.heartbeat.Reset(interval)
+}
+
+func (s *EventSender[T]) heartbeats() {
+	for {
+		select {
+		case <-s.heartbeat.C:
+			if err := s.write([]byte(":\n\n")); err != nil {
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// start sends the status line and headers of the stream.
+func (s *EventSender[T]) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startLocked()
+}
+
+func (s *EventSender[T]) startLocked() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+
+	header := s.ctx.ResponseWriter().Header()
+	header.Set(xContentType, contentTypeEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	s.ctx.SetStatus(http.StatusOK)
+	return s.ctx.res.FlushError()
+}
+
+func (s *EventSender[T]) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.stop:
+		return ErrStreamClosed
+	default:
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := s.startLocked(); err != nil {
+		return err
+	}
+	if _, err := s.ctx.res.Write(b); err != nil {
+		return err
+	}
+	return s.ctx.res.FlushError()
+}
+
+func (s *EventSender[T]) close() {
+	s.heartbeat.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.stop)
+}
+
+func writeField(buf *bytes.Buffer, name, value string) {
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,257 @@
+package router
+
+import (
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+const (
+	contentTypeNdjson = "application/x-ndjson"
+	contentTypeCsv    = "text/csv"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// streamElem returns the element type of t when it is an iter.Seq, or an
+// iter.Seq2 whose second value is an error. It returns nil otherwise.
+func streamElem(t reflect.Type) reflect.Type {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return nil
+	}
+
+	yield := t.In(0)
+	if yield.Kind() != reflect.Func || yield.NumOut() != 1 || yield.Out(0).Kind() != reflect.Bool {
+		return nil
+	}
+
+	switch {
+	case yield.NumIn() == 1:
+		return yield.In(0)
+	case yield.NumIn() == 2 && yield.In(1) == errorType:
+		return yield.In(0)
+	default:
+		return nil
+	}
+}
+
+// streamContentTypes returns the media types a stream of elem can be
+// encoded as.
+func streamContentTypes(elem reflect.Type) []string {
+	contentTypes := []string{contentTypeNdjson, contentTypeJson}
+	if indirect(elem).Kind() == reflect.Struct {
+		contentTypes = append(contentTypes, contentTypeCsv)
+	}
+	return contentTypes
+}
+
+// eachElement calls fn with the elements of the iterator seq until it is
+// exhausted, yields an error, fn fails or ctx is done.
+func eachElement(ctx context.Context, seq reflect.Value, fn func(reflect.Value) error) error {
+	if !seq.IsValid() || seq.IsNil() {
+		return nil
+	}
+
+	var err error
+	yield := reflect.MakeFunc(seq.Type().In(0), func(args []reflect.Value) []reflect.Value {
+		if len(args) == 2 && !args[1].IsNil() {
+			err = args[1].Interface().(error)
+		} else if err = ctx.Err(); err == nil {
+			err = fn(args[0])
+		}
+		return []reflect.Value{reflect.ValueOf(err == nil)}
+	})
+	seq.Call([]reflect.Value{yield})
+	return err
+}
+
+// writeStream encodes the iterator returned by the handler element by
+// element, flushing after each of them. Nothing is written before the first
+// element, so errors yielded up to then still produce an error response.
+func (r *route[Input, Output, Ctx]) writeStream(ctx *ContextAny) {
+	ctx.SetHeader(xContentType, ctx.contentType)
+	enc := newStreamEncoder(ctx.contentType, ctx.res, r.stream)
+
+	err := eachElement(ctx, reflect.ValueOf(ctx.output), func(v reflect.Value) error {
+		if err := enc.encode(v); err != nil {
+			return err
+		}
+		return ctx.res.FlushError()
+	})
+	if err == nil {
+		err = enc.end()
+	}
+	if err != nil {
+		// a truncated stream is left without its closing delimiter
+		r.handleError(ctx, err)
+		return
+	}
+	ctx.res.commit()
+}
+
+type streamEncoder interface {
+	encode(v reflect.Value) error
+	end() error
+}
+
+func newStreamEncoder(contentType string, w io.Writer, elem reflect.Type) streamEncoder {
+	switch contentType {
+	case contentTypeJson:
+		return &jsonArrayEncoder{w: w}
+	case contentTypeCsv:
+		return newCsvEncoder(w, elem)
+	default:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}
+	}
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) encode(v reflect.Value) error {
+	return e.enc.Encode(v.Interface())
+}
+
+func (e *ndjsonEncoder) end() error {
+	return nil
+}
+
+type jsonArrayEncoder struct {
+	w       io.Writer
+	started bool
+}
+
+func (e *jsonArrayEncoder) encode(v reflect.Value) error {
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+
+	sep := ","
+	if !e.started {
+		sep, e.started = "[", true
+	}
+	_, err = io.WriteString(e.w, sep)
+	if err == nil {
+		_, err = e.w.Write(data)
+	}
+	return err
+}
+
+func (e *jsonArrayEncoder) end() error {
+	closing := "]\n"
+	if !e.started {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
+
+// csvEncoder writes struct elements as CSV rows, preceded by a header row
+// holding the JSON names of their fields.
+type csvEncoder struct {
+	w       *csv.Writer
+	fields  []int
+	header  []string
+	started bool
+}
+
+func newCsvEncoder(w io.Writer, elem reflect.Type) *csvEncoder {
+	e := &csvEncoder{w: csv.NewWriter(w)}
+	elem = indirect(elem)
+	for i := 0; i < elem.NumField(); i++ {
+		f := elem.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, skip := propName(f)
+		if skip {
+			continue
+		}
+		e.fields = append(e.fields, i)
+		e.header = append(e.header, name)
+	}
+	return e
+}
+
+func (e *csvEncoder) encode(v reflect.Value) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	record := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		s, err := textValue(v.Field(field))
+		if err != nil {
+			return err
+		}
+		record[i] = s
+	}
+	if err := e.w.Write(record); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) end() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	return e.w.Write(e.header)
+}
+
+// textValue formats a value as text, for CSV cells and form fields. Values
+// that are neither scalars nor text marshalers are written as JSON.
+func textValue(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface()), nil
+	default:
+		data, err := json.Marshal(v.Interface())
+		return string(data), err
+	}
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,454 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pb33f/libopenapi/datamodel/high/base"
+	"go.grass.garden/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const validateTag = "validate"
+
+var (
+	typeRules sync.Map // map[reflect.Type][][]rule, by field index
+	uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// rule is a single constraint of a validate struct tag, such as min=1.
+type rule struct {
+	name  string
+	param string
+	limit float64        // parameter of min, max and len
+	re    *regexp.Regexp // parameter of pattern
+}
+
+// parseRules parses a validate tag of the form "required,min=1,max=10".
+// Since regular expressions may contain commas, pattern must be the last
+// rule of the tag.
+func parseRules(tag string) ([]rule, error) {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "pattern=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+
+		r := rule{name: name, param: param}
+		var err error
+		switch name {
+		case "min", "max", "len":
+			if r.limit, err = strconv.ParseFloat(param, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s rule %q", name, param)
+			}
+		case "pattern":
+			if r.re, err = regexp.Compile(param); err != nil {
+				return nil, fmt.Errorf("invalid pattern rule %q: %w", param, err)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func hasRule(rules []rule, name string) bool {
+	for _, r := range rules {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// structRules returns the rules of the fields of the struct type t, indexed
+// like its fields. It panics when a validate tag is invalid.
+func structRules(t reflect.Type) [][]rule {
+	if rules, ok := typeRules.Load(t); ok {
+		return rules.([][]rule)
+	}
+
+	rules := make([][]rule, t.NumField())
+	for i := range rules {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		own, err := parseRules(f.Tag.Get(validateTag))
+		if err != nil {
+			panic(fmt.Sprintf("router: %s.%s: %v", t, f.Name, err))
+		}
+		annotated, err := parseRules(annotationRules(f))
+		if err != nil {
+			panic(fmt.Sprintf("router: %s.%s: %v", t, f.Name, err))
+		}
+		rules[i] = append(own, annotated...)
+	}
+
+	typeRules.Store(t, rules)
+	return rules
+}
+
+// annotationRules returns the validate rules equivalent to the constraint
+// annotations of a field, so that the constraints documented in its schema
+// are also enforced. Pattern comes last, as parseRules requires.
+func annotationRules(sf reflect.StructField) string {
+	var numeric, text bool
+	switch indirect(sf.Type).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		numeric = true
+	case reflect.String:
+		text = true
+	}
+
+	var rules []string
+	add := func(tag, name string) {
+		if v, ok := sf.Tag.Lookup(tag); ok {
+			rules = append(rules, name+"="+v)
+		}
+	}
+	if numeric {
+		add("minimum", "min")
+		add("maximum", "max")
+	}
+	if text {
+		add("minLength", "min")
+		add("maxLength", "max")
+	}
+	add("enum", "enum")
+	if text {
+		add("pattern", "pattern")
+	}
+
+	return strings.Join(rules, ",")
+}
+
+// checkRules parses the validate tags of t and the types it contains, so
+// that invalid tags are reported when a route is registered.
+func checkRules(t reflect.Type) {
+	var check func(reflect.Type)
+	seen := map[reflect.Type]bool{}
+	check = func(t reflect.Type) {
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			check(t.Elem())
+		case reflect.Struct:
+			structRules(t)
+			for i := 0; i < t.NumField(); i++ {
+				if f := t.Field(i); f.IsExported() {
+					check(f.Type)
+				}
+			}
+		}
+	}
+	check(t)
+}
+
+// validate checks the validate tags of v and its nested structs. It returns
+// an UnprocessableEntityError with one ErrorItem per failing rule. Rules other
+// than required do not apply to the zero value of a field the schema does not
+// mark as required, such as a nil pointer or an omitempty field.
+func validate(v reflect.Value) error {
+	var items []ErrorItem
+	validateStruct(v, "", &items)
+	if len(items) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(items))
+	for i, item := range items {
+		errs[i] = fmt.Errorf("%s: %s", item.Name, item.Reason)
+	}
+
+	return UnprocessableEntityError{
+		Err:    errors.Join(errs...),
+		Detail: "Request validation failed",
+		Errors: items,
+	}
+}
+
+func validateStruct(v reflect.Value, path string, items *[]ErrorItem) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateStruct(v.Index(i), path+"["+strconv.Itoa(i)+"]", items)
+		}
+		return
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateStruct(iter.Value(), joinPath(path, fmt.Sprint(iter.Key().Interface())), items)
+		}
+		return
+	default:
+		return
+	}
+
+	t := v.Type()
+	rules := structRules(t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := paramName(f)
+		if name == "" {
+			prop, skip := propName(f)
+			if skip {
+				continue
+			}
+			name = joinPath(path, prop)
+		}
+
+		fv := v.Field(i)
+		if len(rules[i]) > 0 {
+			validateValue(fv, name, rules[i], optional(f, rules[i]), items)
+		}
+		validateStruct(fv, name, items)
+	}
+}
+
+// optional reports whether the zero value of a field means it was not sent,
+// like the schema documents it: parameters unless they are required, and
+// properties that isRequired does not mark as required.
+func optional(sf reflect.StructField, rules []rule) bool {
+	if isParam(sf) {
+		return !hasRule(rules, "required") && !tagBool(sf, "required")
+	}
+	return !isRequired(sf, rules, "json", formTag)
+}
+
+func validateValue(v reflect.Value, path string, rules []rule, optional bool, items *[]ErrorItem) {
+	fail := func(r rule, reason string) {
+		metadata := map[string]any{"rule": r.name}
+		if r.param != "" {
+			metadata["param"] = r.param
+		}
+		*items = append(*items, ErrorItem{Name: path, Reason: reason, Metadata: metadata})
+	}
+
+	// values behind pointers were sent, even when they are zero
+	present := false
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if hasRule(rules, "required") {
+				fail(rule{name: "required"}, "is required")
+			}
+			return
+		}
+		v = v.Elem()
+		present = true
+	}
+
+	// zero values of optional fields are absent, other rules do not apply
+	if v.IsZero() && optional && !present {
+		if hasRule(rules, "required") {
+			fail(rule{name: "required"}, "is required")
+		}
+		return
+	}
+
+	for _, r := range rules {
+		switch r.name {
+		case "required":
+			if v.IsZero() {
+				fail(r, "is required")
+				return
+			}
+		case "min", "max", "len":
+			n, unit, ok := measure(v)
+			if !ok {
+				continue
+			}
+
+			switch {
+			case r.name == "min" && n < r.limit:
+				fail(r, fmt.Sprintf("must be at least %s%s", r.param, unit))
+			case r.name == "max" && n > r.limit:
+				fail(r, fmt.Sprintf("must be at most %s%s", r.param, unit))
+			case r.name == "len" && n != r.limit:
+				fail(r, fmt.Sprintf("must be exactly %s%s", r.param, unit))
+			}
+		case "pattern":
+			if v.Kind() == reflect.String && !r.re.MatchString(v.String()) {
+				fail(r, fmt.Sprintf("must match pattern %s", r.param))
+			}
+		case "enum":
+			value := fmt.Sprint(v.Interface())
+			if !hasEnumValue(r.param, value) {
+				fail(r, fmt.Sprintf("must be one of %s", strings.ReplaceAll(r.param, "|", ", ")))
+			}
+		case "format":
+			if v.Kind() == reflect.String && v.Len() > 0 && !validFormat(r.param, v.String()) {
+				fail(r, fmt.Sprintf("must be a valid %s", r.param))
+			}
+		}
+	}
+}
+
+// measure returns the value that min, max and len compare against: the value
+// of numbers, and the length of strings, slices, arrays and maps.
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice, reflect.Array:
+		return float64(v.Len()), " items", true
+	case reflect.Map:
+		return float64(v.Len()), " properties", true
+	default:
+		return 0, "", false
+	}
+}
+
+func hasEnumValue(enum, value string) bool {
+	for _, e := range strings.Split(enum, "|") {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+func validFormat(format, value string) bool {
+	switch format {
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "uuid":
+		return uuidRegex.MatchString(value)
+	case "uri":
+		u, err := url.ParseRequestURI(value)
+		return err == nil && u.Scheme != ""
+	default:
+		return true
+	}
+}
+
+// paramName returns the name of the request parameter bound to sf, if any.
+func paramName(sf reflect.StructField) string {
+	for _, in := range paramLocations {
+		if name := sf.Tag.Get(in); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// applyRules reflects the rules of a validate tag into the schema of the
+// field they are declared on.
+func applyRules(s *base.Schema, rules []rule) {
+	kind := ""
+	if len(s.Type) > 0 {
+		kind = s.Type[0]
+	}
+
+	for _, r := range rules {
+		switch r.name {
+		case "min", "max", "len":
+			n := r.limit
+			lower := r.name == "min" || r.name == "len"
+			upper := r.name == "max" || r.name == "len"
+
+			switch kind {
+			case "integer", "number":
+				if lower {
+					s.Minimum = utils.ToPointer(n)
+				}
+				if upper {
+					s.Maximum = utils.ToPointer(n)
+				}
+			case "string":
+				if lower {
+					s.MinLength = utils.ToPointer(int64(n))
+				}
+				if upper {
+					s.MaxLength = utils.ToPointer(int64(n))
+				}
+			case "array":
+				if lower {
+					s.MinItems = utils.ToPointer(int64(n))
+				}
+				if upper {
+					s.MaxItems = utils.ToPointer(int64(n))
+				}
+			case "object":
+				if lower {
+					s.MinProperties = utils.ToPointer(int64(n))
+				}
+				if upper {
+					s.MaxProperties = utils.ToPointer(int64(n))
+				}
+			}
+		case "pattern":
+			s.Pattern = r.param
+		case "enum":
+			s.Enum = nil
+			for _, e := range strings.Split(r.param, "|") {
+				s.Enum = append(s.Enum, scalarNode(kind, e))
+			}
+		case "format":
+			s.Format = r.param
+		}
+	}
+}
+
+// scalarNode returns a YAML node holding value, tagged according to the
+// schema type it belongs to.
+func scalarNode(kind, value string) *yaml.Node {
+	tag := "!!str"
+	switch kind {
+	case "integer":
+		tag = "!!int"
+	case "number":
+		tag = "!!float"
+	case "boolean":
+		tag = "!!bool"
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
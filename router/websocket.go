@@ -0,0 +1,446 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	websocketGUID    = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketVersion = "13"
+
+	defaultMaxMessageSize = 1 << 20
+	closeTimeout          = time.Second
+)
+
+// Close codes defined by RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseAbnormalClosure  = 1006
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var _ error = (*CloseError)(nil)
+
+// CloseError is returned by WebSocketConn.Read once the connection is closed.
+// Handlers may also return it to close the connection with a specific code.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with code %d: %s", e.Code, e.Reason)
+}
+
+type WebSocketHandler[In, Out any] func(*ContextAny, *WebSocketConn[In, Out]) error
+
+// WebSocketConn is an upgraded WebSocket connection exchanging In messages
+// from the client and Out messages to it, encoded with the route's
+// serializer. Reads must happen from a single goroutine; writes are safe for
+// concurrent use.
+type WebSocketConn[In, Out any] struct {
+	conn       net.Conn
+	br         *bufio.Reader
+	serializer Serializer
+	opcode     byte
+
+	maxMessageSize int64
+
+	writeMu     sync.Mutex
+	closeSent   bool
+	closeRecved bool
+}
+
+// WebSocket registers a GET route upgrading requests to the WebSocket
+// protocol. Requests that are not upgrade requests fail with
+// UpgradeRequiredError, and cross-origin requests with ForbiddenError unless
+// allowed by WithWebSocketOrigin. When the handler returns, the connection is
+// closed with CloseNormalClosure, the code of a returned *CloseError, or
+// CloseInternalError for other errors, which are passed to the error
+// processors.
+func WebSocket[In, Out any](
+	r *Router,
+	pattern string,
+	handler WebSocketHandler[In, Out],
+) *route[In, Out, *Context[In]] {
+	var ro *route[In, Out, *Context[In]]
+	ro = newRoute(r, http.MethodGet, pattern, func(ctx *Context[In]) (Out, error) {
+		var zero Out
+		if !r.checkOrigin(ctx.Request()) {
+			return zero, ForbiddenError{
+				Err:    fmt.Errorf("websocket: origin %q not allowed", ctx.Header("Origin")),
+				Detail: "Cross-origin WebSocket connections are not allowed",
+			}
+		}
+
+		conn, err := upgradeWebSocket[In, Out](ctx.ContextAny, ro.serializer)
+		if err != nil {
+			return zero, err
+		}
+		defer conn.conn.Close()
+
+		err = handler(ctx.ContextAny, conn)
+
+		var closeErr *CloseError
+		switch {
+		case err == nil:
+			_ = conn.Close(CloseNormalClosure, "")
+		case errors.As(err, &closeErr):
+			_ = conn.Close(closeErr.Code, closeErr.Reason)
+		default:
+			// the response is gone, the error still goes through the processors
+			_ = ro.processError(err)
+			_ = conn.Close(CloseInternalError, "")
+		}
+		conn.awaitClose()
+		return zero, nil
+	})
+
+	ro.statusCode = http.StatusSwitchingProtocols
+	ro.produces = []string{ro.contentType}
+	ro.consumes = []string{ro.contentType}
+	r.addRoute(ro)
+	return ro
+}
+
+// sameOrigin reports whether the Origin header of req, when present, matches
+// its host. Browsers always send it with WebSocket handshakes.
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+func upgradeWebSocket[In, Out any](ctx *ContextAny, serializer Serializer) (*WebSocketConn[In, Out], error) {
+	req := ctx.Request()
+	if !headerContainsToken(req.Header, "Connection", "upgrade") ||
+		!headerContainsToken(req.Header, "Upgrade", "websocket") {
+		ctx.SetHeader("Upgrade", "websocket")
+		ctx.SetHeader("Connection", "Upgrade")
+		return nil, UpgradeRequiredError{
+			Err:    errors.New("websocket: not an upgrade request"),
+			Detail: "This endpoint requires a WebSocket upgrade",
+		}
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != websocketVersion {
+		ctx.SetHeader("Sec-WebSocket-Version", websocketVersion)
+		return nil, UpgradeRequiredError{
+			Err:    errors.New("websocket: unsupported version"),
+			Detail: "Only version " + websocketVersion + " of the WebSocket protocol is supported",
+		}
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, BadRequestError{
+			Err:    errors.New("websocket: invalid Sec-WebSocket-Key"),
+			Detail: "The Sec-WebSocket-Key header is missing or invalid",
+		}
+	}
+
+	conn, brw, err := ctx.res.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := brw.WriteString(handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	opcode := byte(opBinary)
+	if ct := serializer.ContentType(); ct == contentTypeJson || strings.HasPrefix(ct, "text/") {
+		opcode = opText
+	}
+
+	return &WebSocketConn[In, Out]{
+		conn:           conn,
+		br:             brw.Reader,
+		serializer:     serializer,
+		opcode:         opcode,
+		maxMessageSize: defaultMaxMessageSize,
+	}, nil
+}
+
+// SetMaxMessageSize limits the size of messages read from the client. Larger
+// messages close the connection with CloseMessageTooBig.
+func (c *WebSocketConn[In, Out]) SetMaxMessageSize(size int64) {
+	c.maxMessageSize = size
+}
+
+// Read returns the next message from the client. Ping frames are answered
+// while reading. Once the client closes the connection, Read returns a
+// *CloseError.
+func (c *WebSocketConn[In, Out]) Read() (In, error) {
+	var msg In
+	data, err := c.ReadRaw()
+	if err != nil {
+		return msg, err
+	}
+
+	if err := c.serializer.Unmarshal(data, &msg); err != nil {
+		_ = c.Close(CloseUnsupportedData, "invalid message")
+		return msg, err
+	}
+	return msg, nil
+}
+
+// ReadRaw returns the payload of the next data message from the client.
+func (c *WebSocketConn[In, Out]) ReadRaw() ([]byte, error) {
+	var message []byte
+	var opcode byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, c.fail(err)
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return nil, c.receiveClose(payload)
+		case opText, opBinary:
+			if opcode != 0 {
+				return nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "expected continuation frame"})
+			}
+			opcode = op
+		case opContinuation:
+			if opcode == 0 {
+				return nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"})
+			}
+		default:
+			return nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "unknown opcode"})
+		}
+
+		if int64(len(message)+len(payload)) > c.maxMessageSize {
+			return nil, c.fail(&CloseError{Code: CloseMessageTooBig, Reason: "message too big"})
+		}
+		message = append(message, payload...)
+
+		if fin {
+			if opcode == opText && !utf8.Valid(message) {
+				return nil, c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"})
+			}
+			return message, nil
+		}
+	}
+}
+
+// Write sends v to the client as a single message.
+func (c *WebSocketConn[In, Out]) Write(v Out) error {
+	var buf bytes.Buffer
+	if err := c.serializer.Marshal(&buf, v); err != nil {
+		return err
+	}
+	return c.writeFrame(c.opcode, bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+// Ping sends a ping frame, which the client answers with a pong.
+func (c *WebSocketConn[In, Out]) Ping(data []byte) error {
+	return c.writeFrame(opPing, data)
+}
+
+// Close sends a close frame with code and reason. Sending further messages
+// fails, reading returns the client's close frame.
+func (c *WebSocketConn[In, Out]) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	return c.writeFrame(opClose, payload)
+}
+
+// RemoteAddr returns the address of the client.
+func (c *WebSocketConn[In, Out]) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// awaitClose waits a short time for the client to acknowledge a close frame,
+// so the client rather than the server ends the TCP connection.
+func (c *WebSocketConn[In, Out]) awaitClose() {
+	if c.closeRecved {
+		return
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	for {
+		_, op, _, err := c.readFrame()
+		if err != nil || op == opClose {
+			return
+		}
+	}
+}
+
+func (c *WebSocketConn[In, Out]) receiveClose(payload []byte) error {
+	c.closeRecved = true
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+
+	// echo the close frame as required by the protocol
+	_ = c.writeFrame(opClose, payload[:min(len(payload), 2)])
+	return closeErr
+}
+
+// fail closes the connection after a protocol violation, reporting err to
+// the client when it is a *CloseError.
+func (c *WebSocketConn[In, Out]) fail(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		_ = c.Close(closeErr.Code, closeErr.Reason)
+		return err
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{Code: CloseAbnormalClosure}
+	}
+	return err
+}
+
+func (c *WebSocketConn[In, Out]) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return fin, opcode, nil, &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return fin, opcode, nil, &CloseError{Code: CloseProtocolError, Reason: "unmasked client frame"}
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if opcode >= opClose && (length > 125 || !fin) {
+		return fin, opcode, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+	}
+	if length < 0 || length > c.maxMessageSize {
+		return fin, opcode, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *WebSocketConn[In, Out]) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrStreamClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}